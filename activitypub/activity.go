@@ -2,6 +2,7 @@ package activitypub
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -86,6 +87,12 @@ func (activity Activity) AddFollowersTo() (Activity, error) {
 }
 
 func (activity Activity) CheckValid() (Collection, bool, error) {
+	return activity.CheckValidContext(context.Background())
+}
+
+// CheckValidContext is CheckValid with a context to cancel or time out the
+// request.
+func (activity Activity) CheckValidContext(ctx context.Context) (Collection, bool, error) {
 	var respCollection Collection
 
 	re := regexp.MustCompile(`(.+\.onion(.+)|.+\.loki(.+)|.+\.i2p(.+))?`)
@@ -93,7 +100,7 @@ func (activity Activity) CheckValid() (Collection, bool, error) {
 		activity.Id = strings.Replace(activity.Id, "https", "http", 1)
 	}
 
-	req, err := http.NewRequest("GET", activity.Id, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", activity.Id, nil)
 	if err != nil {
 		return respCollection, false, util.MakeError(err, "CheckValid")
 	}
@@ -112,7 +119,7 @@ func (activity Activity) CheckValid() (Collection, bool, error) {
 		return respCollection, false, util.MakeError(err, "CheckValid")
 	}
 
-	if respCollection.AtContext.Context == "https://www.w3.org/ns/activitystreams" && respCollection.OrderedItems[0].Id != "" {
+	if respCollection.AtContext.Context == "https://www.w3.org/ns/activitystreams" && len(respCollection.OrderedItems) > 0 && respCollection.OrderedItems[0].Id != "" {
 		return respCollection, true, nil
 	}
 
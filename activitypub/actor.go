@@ -207,6 +207,74 @@ func (actor Actor) GetAutoSubscribe() (bool, error) {
 	return subscribed, nil
 }
 
+func (actor Actor) GetDice() (bool, error) {
+	var dice bool
+
+	query := `select dice from actor where id=$1`
+	if err := config.DB.QueryRow(query, actor.Id).Scan(&dice); err != nil {
+		return false, util.MakeError(err, "GetDice")
+	}
+
+	return dice, nil
+}
+
+// GetCooldowns returns the seconds a poster has to wait on the board
+// between threads, between replies and before posting the same comment again.
+func (actor Actor) GetCooldowns() (int, int, int, error) {
+	var thread, reply, duplicate int
+
+	query := `select threadcooldown, replycooldown, duplicatecooldown from actor where id=$1`
+	if err := config.DB.QueryRow(query, actor.Id).Scan(&thread, &reply, &duplicate); err != nil {
+		return 0, 0, 0, util.MakeError(err, "GetCooldowns")
+	}
+
+	return thread, reply, duplicate, nil
+}
+
+func (actor Actor) GetR9K() (bool, error) {
+	var r9k bool
+
+	query := `select r9k from actor where id=$1`
+	if err := config.DB.QueryRow(query, actor.Id).Scan(&r9k); err != nil {
+		return false, util.MakeError(err, "GetR9K")
+	}
+
+	return r9k, nil
+}
+
+func (actor Actor) GetPublicModLog() (bool, error) {
+	var public bool
+
+	query := `select publicmodlog from actor where id=$1`
+	if err := config.DB.QueryRow(query, actor.Id).Scan(&public); err != nil {
+		return false, util.MakeError(err, "GetPublicModLog")
+	}
+
+	return public, nil
+}
+
+func (actor Actor) GetFlags() (bool, error) {
+	var flags bool
+
+	query := `select flags from actor where id=$1`
+	if err := config.DB.QueryRow(query, actor.Id).Scan(&flags); err != nil {
+		return false, util.MakeError(err, "GetFlags")
+	}
+
+	return flags, nil
+}
+
+func (actor Actor) GetPosterIDs() (bool, error) {
+	var posterIDs bool
+
+	query := `select posterids from actor where id=$1`
+	if err := config.DB.QueryRow(query, actor.Id).Scan(&posterIDs); err != nil {
+		return false, util.MakeError(err, "GetPosterIDs")
+	}
+
+	return posterIDs, nil
+}
+
 func (actor Actor) GetCatalogCollection() (Collection, error) {
 	var nColl Collection
 	var result []ObjectBase
@@ -214,7 +282,7 @@ func (actor Actor) GetCatalogCollection() (Collection, error) {
 	var err error
 	var rows *sql.Rows
 
-	query := `select x.id, x.name, x.content, x.type, x.published, x.updated, x.attributedto, x.attachment, x.preview, x.actor, x.tripcode, x.sensitive from (select id, name, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive from activitystream where actor=$1 and id in (select id from replies where inreplyto='') and type='Note' and id not in (select activity_id from sticky where actor_id=$1) union select id, name, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive from activitystream where actor in (select following from following where id=$1) and id in (select id from replies where inreplyto='') and type='Note' and id not in (select activity_id from sticky where actor_id=$1) union select id, name, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive from cacheactivitystream where actor in (select following from following where id=$1) and id in (select id from replies where inreplyto='') and type='Note' and id not in (select activity_id from sticky where actor_id=$1)) as x order by x.updated desc limit 165`
+	query := `select x.id, x.name, x.content, x.type, x.published, x.updated, x.attributedto, x.attachment, x.preview, x.actor, x.tripcode, x.sensitive, x.posterid from (select id, name, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive, posterid from activitystream where actor=$1 and id in (select id from replies where inreplyto='') and type='Note' and id not in (select activity_id from sticky where actor_id=$1) union select id, name, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive, posterid from activitystream where actor in (select following from following where id=$1) and id in (select id from replies where inreplyto='') and type='Note' and id not in (select activity_id from sticky where actor_id=$1) union select id, name, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive, posterid from cacheactivitystream where actor in (select following from following where id=$1) and id in (select id from replies where inreplyto='') and type='Note' and id not in (select activity_id from sticky where actor_id=$1)) as x order by x.updated desc limit 165`
 
 	if rows, err = config.DB.Query(query, actor.Id); err != nil {
 		return nColl, util.MakeError(err, "GetCatalogCollection")
@@ -237,7 +305,7 @@ func (actor Actor) GetCatalogCollection() (Collection, error) {
 		var prev NestedObjectBase
 		post.Preview = &prev
 
-		err = rows.Scan(&post.Id, &post.Name, &post.Content, &post.Type, &post.Published, &post.Updated, &post.AttributedTo, &post.Attachment[0].Id, &post.Preview.Id, &actor.Id, &post.TripCode, &post.Sensitive)
+		err = rows.Scan(&post.Id, &post.Name, &post.Content, &post.Type, &post.Published, &post.Updated, &post.AttributedTo, &post.Attachment[0].Id, &post.Preview.Id, &actor.Id, &post.TripCode, &post.Sensitive, &post.PosterId)
 
 		if err != nil {
 			return nColl, util.MakeError(err, "GetCatalogCollection")
@@ -262,6 +330,10 @@ func (actor Actor) GetCatalogCollection() (Collection, error) {
 			return nColl, util.MakeError(err, "GetCatalogCollection")
 		}
 
+		post.Tag, _ = post.GetTags()
+		post.Backlinks, _ = post.GetBacklinks()
+		post, _ = post.GetPoll()
+
 		post.Preview, err = post.Preview.GetPreview()
 
 		if err != nil {
@@ -285,7 +357,7 @@ func (actor Actor) GetCollectionPage(page int) (Collection, error) {
 	var err error
 	var rows *sql.Rows
 
-	query := `select count (x.id) over(), x.id, x.name, x.alias, x.content, x.type, x.published, x.updated, x.attributedto, x.attachment, x.preview, x.actor, x.tripcode, x.sensitive from (select id, name, alias, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive from activitystream where actor=$1 and id in (select id from replies where inreplyto='') and type='Note' and id not in (select activity_id from sticky where actor_id=$1) union select id, name, alias, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive from activitystream where actor in (select following from following where id=$1) and id in (select id from replies where inreplyto='') and type='Note' and id not in (select activity_id from sticky where actor_id=$1) union select id, name, alias, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive from cacheactivitystream where id not in (select activity_id from sticky where actor_id=$1) and actor in (select following from following where id=$1) and id in (select id from replies where inreplyto='') and type='Note') as x order by x.updated desc limit $2 offset $3`
+	query := `select count (x.id) over(), x.id, x.name, x.alias, x.content, x.type, x.published, x.updated, x.attributedto, x.attachment, x.preview, x.actor, x.tripcode, x.sensitive, x.posterid from (select id, name, alias, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive, posterid from activitystream where actor=$1 and id in (select id from replies where inreplyto='') and type='Note' and id not in (select activity_id from sticky where actor_id=$1) union select id, name, alias, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive, posterid from activitystream where actor in (select following from following where id=$1) and id in (select id from replies where inreplyto='') and type='Note' and id not in (select activity_id from sticky where actor_id=$1) union select id, name, alias, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive, posterid from cacheactivitystream where id not in (select activity_id from sticky where actor_id=$1) and actor in (select following from following where id=$1) and id in (select id from replies where inreplyto='') and type='Note') as x order by x.updated desc limit $2 offset $3`
 
 	limit := 15
 
@@ -316,7 +388,7 @@ func (actor Actor) GetCollectionPage(page int) (Collection, error) {
 		var prev NestedObjectBase
 		post.Preview = &prev
 
-		err = rows.Scan(&count, &post.Id, &post.Name, &post.Alias, &post.Content, &post.Type, &post.Published, &post.Updated, &post.AttributedTo, &post.Attachment[0].Id, &post.Preview.Id, &actor.Id, &post.TripCode, &post.Sensitive)
+		err = rows.Scan(&count, &post.Id, &post.Name, &post.Alias, &post.Content, &post.Type, &post.Published, &post.Updated, &post.AttributedTo, &post.Attachment[0].Id, &post.Preview.Id, &actor.Id, &post.TripCode, &post.Sensitive, &post.PosterId)
 
 		if err != nil {
 			return nColl, util.MakeError(err, "GetCollectionPage")
@@ -337,6 +409,10 @@ func (actor Actor) GetCollectionPage(page int) (Collection, error) {
 			return nColl, util.MakeError(err, "GetCollectionPage")
 		}
 
+		post.Tag, _ = post.GetTags()
+		post.Backlinks, _ = post.GetBacklinks()
+		post, _ = post.GetPoll()
+
 		post.Preview, err = post.Preview.GetPreview()
 
 		if err != nil {
@@ -359,7 +435,7 @@ func (actor Actor) GetCollection() (Collection, error) {
 	var nColl Collection
 	var result []ObjectBase
 
-	query := `select id, name, alias, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive from activitystream where actor=$1 and id in (select id from replies where inreplyto='') and type='Note' order by updated desc`
+	query := `select id, name, alias, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive, posterid from activitystream where actor=$1 and id in (select id from replies where inreplyto='') and type='Note' order by updated desc`
 	rows, err := config.DB.Query(query, actor.Id)
 
 	if err != nil {
@@ -377,7 +453,7 @@ func (actor Actor) GetCollection() (Collection, error) {
 		var prev NestedObjectBase
 		post.Preview = &prev
 
-		if err := rows.Scan(&post.Id, &post.Name, &post.Alias, &post.Content, &post.Type, &post.Published, &post.Updated, &post.AttributedTo, &post.Attachment[0].Id, &post.Preview.Id, &actor.Id, &post.TripCode, &post.Sensitive); err != nil {
+		if err := rows.Scan(&post.Id, &post.Name, &post.Alias, &post.Content, &post.Type, &post.Published, &post.Updated, &post.AttributedTo, &post.Attachment[0].Id, &post.Preview.Id, &actor.Id, &post.TripCode, &post.Sensitive, &post.PosterId); err != nil {
 			return nColl, util.MakeError(err, "GetCollection")
 		}
 
@@ -398,6 +474,10 @@ func (actor Actor) GetCollection() (Collection, error) {
 			return nColl, util.MakeError(err, "GetCollection")
 		}
 
+		post.Tag, _ = post.GetTags()
+		post.Backlinks, _ = post.GetBacklinks()
+		post, _ = post.GetPoll()
+
 		post.Preview, err = post.Preview.GetPreview()
 
 		if err != nil {
@@ -418,7 +498,7 @@ func (actor Actor) GetCollectionType(nType string) (Collection, error) {
 	var nColl Collection
 	var result []ObjectBase
 
-	query := `select x.id, x.name, x.alias, x.content, x.type, x.published, x.updated, x.attributedto, x.attachment, x.preview, x.actor, x.tripcode, x.sensitive from (select id, name, alias, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive from activitystream where actor=$1 and id in (select id from replies where inreplyto='') and type=$2 union select id, name, alias, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive from activitystream where actor in (select following from following where id=$1) and id in (select id from replies where inreplyto='') and type=$2 union select id, name, alias, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive from cacheactivitystream where actor in (select following from following where id=$1) and id in (select id from replies where inreplyto='') and type=$2) as x order by x.updated desc`
+	query := `select x.id, x.name, x.alias, x.content, x.type, x.published, x.updated, x.attributedto, x.attachment, x.preview, x.actor, x.tripcode, x.sensitive, x.posterid from (select id, name, alias, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive, posterid from activitystream where actor=$1 and id in (select id from replies where inreplyto='') and type=$2 union select id, name, alias, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive, posterid from activitystream where actor in (select following from following where id=$1) and id in (select id from replies where inreplyto='') and type=$2 union select id, name, alias, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive, posterid from cacheactivitystream where actor in (select following from following where id=$1) and id in (select id from replies where inreplyto='') and type=$2) as x order by x.updated desc`
 	rows, err := config.DB.Query(query, actor.Id, nType)
 	if err != nil {
 		return nColl, util.MakeError(err, "GetCollectionType")
@@ -435,7 +515,7 @@ func (actor Actor) GetCollectionType(nType string) (Collection, error) {
 		var prev NestedObjectBase
 		post.Preview = &prev
 
-		if err := rows.Scan(&post.Id, &post.Name, &post.Alias, &post.Content, &post.Type, &post.Published, &post.Updated, &post.AttributedTo, &post.Attachment[0].Id, &post.Preview.Id, &actor.Id, &post.TripCode, &post.Sensitive); err != nil {
+		if err := rows.Scan(&post.Id, &post.Name, &post.Alias, &post.Content, &post.Type, &post.Published, &post.Updated, &post.AttributedTo, &post.Attachment[0].Id, &post.Preview.Id, &actor.Id, &post.TripCode, &post.Sensitive, &post.PosterId); err != nil {
 			return nColl, util.MakeError(err, "GetCollectionType")
 		}
 
@@ -455,6 +535,10 @@ func (actor Actor) GetCollectionType(nType string) (Collection, error) {
 			return nColl, util.MakeError(err, "GetCollectionType")
 		}
 
+		post.Tag, _ = post.GetTags()
+		post.Backlinks, _ = post.GetBacklinks()
+		post, _ = post.GetPoll()
+
 		post.Preview, err = post.Preview.GetPreview()
 		if err != nil {
 			return nColl, util.MakeError(err, "GetCollectionType")
@@ -472,7 +556,7 @@ func (actor Actor) GetCollectionTypeLimit(nType string, limit int) (Collection,
 	var nColl Collection
 	var result []ObjectBase
 
-	query := `select x.id, x.name, x.alias, x.content, x.type, x.published, x.updated, x.attributedto, x.attachment, x.preview, x.actor, x.tripcode, x.sensitive from (select id, name, alias, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive from activitystream where actor=$1 and id in (select id from replies where inreplyto='') and type=$2 union select id, name, alias, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive from activitystream where actor in (select following from following where id=$1) and id in (select id from replies where inreplyto='') and type=$2 union select id, name, alias, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive from cacheactivitystream where actor in (select following from following where id=$1) and id in (select id from replies where inreplyto='') and type=$2) as x order by x.updated desc limit $3`
+	query := `select x.id, x.name, x.alias, x.content, x.type, x.published, x.updated, x.attributedto, x.attachment, x.preview, x.actor, x.tripcode, x.sensitive, x.posterid from (select id, name, alias, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive, posterid from activitystream where actor=$1 and id in (select id from replies where inreplyto='') and type=$2 union select id, name, alias, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive, posterid from activitystream where actor in (select following from following where id=$1) and id in (select id from replies where inreplyto='') and type=$2 union select id, name, alias, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive, posterid from cacheactivitystream where actor in (select following from following where id=$1) and id in (select id from replies where inreplyto='') and type=$2) as x order by x.updated desc limit $3`
 	rows, err := config.DB.Query(query, actor.Id, nType, limit)
 
 	if err != nil {
@@ -490,7 +574,7 @@ func (actor Actor) GetCollectionTypeLimit(nType string, limit int) (Collection,
 		var prev NestedObjectBase
 		post.Preview = &prev
 
-		if err := rows.Scan(&post.Id, &post.Name, &post.Alias, &post.Content, &post.Type, &post.Published, &post.Updated, &post.AttributedTo, &post.Attachment[0].Id, &post.Preview.Id, &actor.Id, &post.TripCode, &post.Sensitive); err != nil {
+		if err := rows.Scan(&post.Id, &post.Name, &post.Alias, &post.Content, &post.Type, &post.Published, &post.Updated, &post.AttributedTo, &post.Attachment[0].Id, &post.Preview.Id, &actor.Id, &post.TripCode, &post.Sensitive, &post.PosterId); err != nil {
 			return nColl, util.MakeError(err, "GetCollectionTypeLimit")
 		}
 
@@ -510,6 +594,10 @@ func (actor Actor) GetCollectionTypeLimit(nType string, limit int) (Collection,
 			return nColl, util.MakeError(err, "GetCollectionTypeLimit")
 		}
 
+		post.Tag, _ = post.GetTags()
+		post.Backlinks, _ = post.GetBacklinks()
+		post, _ = post.GetPoll()
+
 		post.Preview, err = post.Preview.GetPreview()
 		if err != nil {
 			return nColl, util.MakeError(err, "GetCollectionTypeLimit")
@@ -750,6 +838,9 @@ func (actor Actor) GetRecentPosts() ([]ObjectBase, error) {
 		isOP, _ := nObj.CheckIfOP()
 
 		nObj.Attachment, _ = attachment.GetAttachment()
+		nObj.Tag, _ = nObj.GetTags()
+		nObj.Backlinks, _ = nObj.GetBacklinks()
+		nObj, _ = nObj.GetPoll()
 
 		if !isOP {
 			var reply ObjectBase
@@ -917,6 +1008,78 @@ func (actor Actor) SetAutoSubscribe() error {
 	return util.MakeError(err, "SetAutoSubscribe")
 }
 
+func (actor Actor) SetDice() error {
+	current, err := actor.GetDice()
+
+	if err != nil {
+		return util.MakeError(err, "SetDice")
+	}
+
+	query := `update actor set dice=$1 where id=$2`
+	_, err = config.DB.Exec(query, !current, actor.Id)
+
+	return util.MakeError(err, "SetDice")
+}
+
+func (actor Actor) SetCooldowns(thread int, reply int, duplicate int) error {
+	query := `update actor set threadcooldown=$1, replycooldown=$2, duplicatecooldown=$3 where id=$4`
+	_, err := config.DB.Exec(query, thread, reply, duplicate, actor.Id)
+
+	return util.MakeError(err, "SetCooldowns")
+}
+
+func (actor Actor) SetR9K() error {
+	current, err := actor.GetR9K()
+
+	if err != nil {
+		return util.MakeError(err, "SetR9K")
+	}
+
+	query := `update actor set r9k=$1 where id=$2`
+	_, err = config.DB.Exec(query, !current, actor.Id)
+
+	return util.MakeError(err, "SetR9K")
+}
+
+func (actor Actor) SetPublicModLog() error {
+	current, err := actor.GetPublicModLog()
+
+	if err != nil {
+		return util.MakeError(err, "SetPublicModLog")
+	}
+
+	query := `update actor set publicmodlog=$1 where id=$2`
+	_, err = config.DB.Exec(query, !current, actor.Id)
+
+	return util.MakeError(err, "SetPublicModLog")
+}
+
+func (actor Actor) SetFlags() error {
+	current, err := actor.GetFlags()
+
+	if err != nil {
+		return util.MakeError(err, "SetFlags")
+	}
+
+	query := `update actor set flags=$1 where id=$2`
+	_, err = config.DB.Exec(query, !current, actor.Id)
+
+	return util.MakeError(err, "SetFlags")
+}
+
+func (actor Actor) SetPosterIDs() error {
+	current, err := actor.GetPosterIDs()
+
+	if err != nil {
+		return util.MakeError(err, "SetPosterIDs")
+	}
+
+	query := `update actor set posterids=$1 where id=$2`
+	_, err = config.DB.Exec(query, !current, actor.Id)
+
+	return util.MakeError(err, "SetPosterIDs")
+}
+
 func (actor Actor) SendToFollowers(activity Activity) error {
 	followers, err := actor.GetFollower()
 
@@ -1174,7 +1337,7 @@ func (actor Actor) DeleteVerification(verify util.Verify) error {
 func (actor Actor) GetJanitors() ([]util.Verify, error) {
 	var list []util.Verify
 
-	query := `select identifier, code, board, type, label from boardaccess where board=$1 and type='janitor'`
+	query := `select identifier, code, board, type, label, permissions, banmax from boardaccess where board=$1 and type in ('janitor', 'mod', 'custom')`
 	rows, err := config.DB.Query(query, actor.Id)
 
 	if err != nil {
@@ -1184,8 +1347,13 @@ func (actor Actor) GetJanitors() ([]util.Verify, error) {
 	defer rows.Close()
 	for rows.Next() {
 		var verify util.Verify
+		var permissions string
+
+		rows.Scan(&verify.Identifier, &verify.Code, &verify.Board, &verify.Type, &verify.Label, &permissions, &verify.BanMax)
 
-		rows.Scan(&verify.Identifier, &verify.Code, &verify.Board, &verify.Type, &verify.Label)
+		if permissions != "" {
+			verify.Permissions = strings.Split(permissions, ",")
+		}
 
 		list = append(list, verify)
 	}
@@ -1210,20 +1378,64 @@ func (actor Actor) ProcessInboxCreate(activity Activity) error {
 				if locked, _ := activity.Object.InReplyTo[0].IsLocked(); locked {
 					return util.MakeError(errors.New("Object locked"), "ActorInbox")
 				}
+
+				if pending, _ := activity.Object.InReplyTo[0].IsPending(); pending {
+					return util.MakeError(errors.New("Object pending"), "ActorInbox")
+				}
 			}
 
 			if wantToCache, err := activity.Object.WantToCache(actor); !wantToCache {
 				return util.MakeError(err, "ActorInbox")
 			}
 
+			hashes := activity.Object.OriginalityHashes()
+
+			if r9k, _ := actor.GetR9K(); r9k {
+				if original, err := actor.IsOriginal(hashes); err != nil {
+					return util.MakeError(err, "ActorInbox")
+				} else if !original {
+					return util.MakeError(errors.New("Object not original"), "ActorInbox")
+				}
+			}
+
+			spam, reasons := SpamAllow, []string{}
+
+			if SpamCheck != nil {
+				var err error
+
+				if spam, reasons, err = SpamCheck(actor, activity.Object); err != nil {
+					return util.MakeError(err, "ActorInbox")
+				} else if spam == SpamReject {
+					return util.MakeError(errors.New("Object rejected as spam"), "ActorInbox")
+				}
+			}
+
 			if col, _ := activity.Object.GetCollectionLocal(); len(col.OrderedItems) != 0 {
 				return nil
 			}
 
+			if approval, _ := actor.NeedsApproval(activity.Object); approval {
+				spam = SpamHold
+			}
+
+			if spam == SpamHold {
+				activity.Object.Type = PendingType
+			}
+
 			if _, err := activity.Object.WriteCache(); err != nil {
 				return util.MakeError(err, "ActorInbox")
 			}
 
+			if err := actor.WriteOriginality(hashes); err != nil {
+				return util.MakeError(err, "ActorInbox")
+			}
+
+			if activity.Object.Type == PendingType {
+				if err := actor.HoldForReview(activity.Object, reasons); err != nil {
+					return util.MakeError(err, "ActorInbox")
+				}
+			}
+
 			if err := actor.ArchivePosts(); err != nil {
 				return util.MakeError(err, "ActorInbox")
 			}
@@ -1249,15 +1461,15 @@ func (actor Actor) GetStickies() (Collection, error) {
 
 	query := `
 select count
-(x.id) over(), x.id, x.name, x.alias, x.content, x.type, x.published, x.updated, x.attributedto, x.attachment, x.preview, x.actor, x.tripcode, x.sensitive
+(x.id) over(), x.id, x.name, x.alias, x.content, x.type, x.published, x.updated, x.attributedto, x.attachment, x.preview, x.actor, x.tripcode, x.sensitive, x.posterid
 	from
-	 (select id, name, alias, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive from activitystream
+	 (select id, name, alias, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive, posterid from activitystream
 		where actor=$1 and id in (select id from replies where inreplyto='') and type='Note' and id in (select activity_id from sticky where actor_id=$1)
 	union
-		select id, name, alias, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive from activitystream
+		select id, name, alias, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive, posterid from activitystream
 		where actor in (select following from following where id=$1) and id in (select id from replies where inreplyto='') and type='Note' and id in (select activity_id from sticky where actor_id=$1)
 	union
-		select id, name, alias, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive from cacheactivitystream where actor in (select following from following where id=$1)
+		select id, name, alias, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive, posterid from cacheactivitystream where actor in (select following from following where id=$1)
 		and id in (select id from replies where inreplyto='') and type='Note' and id in (select activity_id from sticky where actor_id=$1)
 ) as x order by x.updated desc limit 15`
 
@@ -1279,7 +1491,7 @@ select count
 		var prev NestedObjectBase
 		post.Preview = &prev
 
-		err = rows.Scan(&count, &post.Id, &post.Name, &post.Alias, &post.Content, &post.Type, &post.Published, &post.Updated, &post.AttributedTo, &post.Attachment[0].Id, &post.Preview.Id, &actor.Id, &post.TripCode, &post.Sensitive)
+		err = rows.Scan(&count, &post.Id, &post.Name, &post.Alias, &post.Content, &post.Type, &post.Published, &post.Updated, &post.AttributedTo, &post.Attachment[0].Id, &post.Preview.Id, &actor.Id, &post.TripCode, &post.Sensitive, &post.PosterId)
 
 		if err != nil {
 			return nColl, util.MakeError(err, "GetStickies")
@@ -1297,6 +1509,9 @@ select count
 		post.Replies.TotalImgs = imgCnt
 
 		post.Attachment, _ = post.Attachment[0].GetAttachment()
+		post.Tag, _ = post.GetTags()
+		post.Backlinks, _ = post.GetBacklinks()
+		post, _ = post.GetPoll()
 
 		post.Preview, _ = post.Preview.GetPreview()
 
@@ -1319,7 +1534,7 @@ func (actor Actor) GetRecentThreads() (Collection, error) {
 
 	// Selects 6 most recently created local/remote threads
 	// Will exclude "hidden" boards when main actor used (only display local boards followed by main actor, and remote boards where the local actor is followed by the main actor)
-	query := `select x.id, x.name, x.content, x.type, x.published, x.updated, x.attributedto, x.attachment, x.preview, x.actor, x.tripcode, x.sensitive from (select id, name, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive from activitystream where actor in (select following from following where id='https://usagi.reisen') and id in (select id from replies where inreplyto='') and type='Note' and id not in (select activity_id from sticky where actor_id=$1) union select id, name, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive from cacheactivitystream where actor in (select following from following where id in (select following from following where id=$1)) and id in (select id from replies where inreplyto='') and type='Note' and id not in (select activity_id from sticky where actor_id=$1)) as x order by x.published desc limit 6`
+	query := `select x.id, x.name, x.content, x.type, x.published, x.updated, x.attributedto, x.attachment, x.preview, x.actor, x.tripcode, x.sensitive, x.posterid from (select id, name, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive, posterid from activitystream where actor in (select following from following where id='https://usagi.reisen') and id in (select id from replies where inreplyto='') and type='Note' and id not in (select activity_id from sticky where actor_id=$1) union select id, name, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive, posterid from cacheactivitystream where actor in (select following from following where id in (select following from following where id=$1)) and id in (select id from replies where inreplyto='') and type='Note' and id not in (select activity_id from sticky where actor_id=$1)) as x order by x.published desc limit 6`
 
 	if rows, err = config.DB.Query(query, actor.Id); err != nil {
 		return nColl, util.MakeError(err, "GetRecentThreads")
@@ -1336,7 +1551,7 @@ func (actor Actor) GetRecentThreads() (Collection, error) {
 		var prev NestedObjectBase
 		post.Preview = &prev
 
-		err = rows.Scan(&post.Id, &post.Name, &post.Content, &post.Type, &post.Published, &post.Updated, &post.AttributedTo, &post.Attachment[0].Id, &post.Preview.Id, &actor.Id, &post.TripCode, &post.Sensitive)
+		err = rows.Scan(&post.Id, &post.Name, &post.Content, &post.Type, &post.Published, &post.Updated, &post.AttributedTo, &post.Attachment[0].Id, &post.Preview.Id, &actor.Id, &post.TripCode, &post.Sensitive, &post.PosterId)
 
 		if err != nil {
 			return nColl, util.MakeError(err, "GetRecentThreads")
@@ -1361,6 +1576,10 @@ func (actor Actor) GetRecentThreads() (Collection, error) {
 			return nColl, util.MakeError(err, "GetRecentThreads")
 		}
 
+		post.Tag, _ = post.GetTags()
+		post.Backlinks, _ = post.GetBacklinks()
+		post, _ = post.GetPoll()
+
 		post.Preview, err = post.Preview.GetPreview()
 
 		if err != nil {
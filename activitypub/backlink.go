@@ -0,0 +1,148 @@
+package activitypub
+
+import (
+	"strings"
+
+	"github.com/FChannel0/FChannel-Server/config"
+	"github.com/FChannel0/FChannel-Server/util"
+)
+
+// Backlinks are the later posts quoting a post. They are indexed when the
+// quoting post is written so they can be shown without scanning content.
+
+// quotes past this are not indexed
+const maxBacklinks = 50
+
+// ParseQuotes returns the links of the posts quoted in content. It is set to
+// the markup parser of the post package when the server starts.
+var ParseQuotes func(content string) []string
+
+// WriteBacklinks indexes the posts quoted in obj.Content as backlinked by obj.
+func (obj ObjectBase) WriteBacklinks() error {
+	if err := obj.DeleteBacklinks(); err != nil {
+		return util.MakeError(err, "WriteBacklinks")
+	}
+
+	if ParseQuotes == nil {
+		return nil
+	}
+
+	var links []string
+	for _, link := range ParseQuotes(obj.Content) {
+		if len(links) >= maxBacklinks {
+			break
+		}
+
+		link = strings.Replace(link, "www.", "", 1)
+		link = strings.Replace(link, "http://", "", 1)
+		link = strings.Replace(link, "https://", "", 1)
+		link = config.TP + "" + link
+
+		if link == obj.Id || len(link) > 2000 || util.IsInStringArray(links, link) {
+			continue
+		}
+
+		links = append(links, link)
+	}
+
+	for _, e := range links {
+		query := `insert into backlinks (id, backlink, published) values ($1, $2, $3)`
+		if _, err := config.DB.Exec(query, e, obj.Id, obj.Published); err != nil {
+			return util.MakeError(err, "WriteBacklinks")
+		}
+	}
+
+	return nil
+}
+
+// BackfillBacklinks indexes the quotes of the stored posts when the backlinks
+// table is empty, so posts made before backlinks were indexed keep their
+// reply links.
+func BackfillBacklinks() error {
+	var exists bool
+
+	query := `select exists (select 1 from backlinks)`
+	if err := config.DB.QueryRow(query).Scan(&exists); err != nil || exists {
+		return util.MakeError(err, "BackfillBacklinks")
+	}
+
+	query = `select id, content, published from activitystream where type='Note' or type='Archive' union select id, content, published from cacheactivitystream where type='Note' or type='Archive'`
+	rows, err := config.DB.Query(query)
+
+	if err != nil {
+		return util.MakeError(err, "BackfillBacklinks")
+	}
+
+	var posts []ObjectBase
+
+	for rows.Next() {
+		var post ObjectBase
+
+		if err := rows.Scan(&post.Id, &post.Content, &post.Published); err != nil {
+			rows.Close()
+			return util.MakeError(err, "BackfillBacklinks")
+		}
+
+		if strings.Contains(post.Content, ">>") {
+			posts = append(posts, post)
+		}
+	}
+
+	rows.Close()
+
+	for _, e := range posts {
+		if err := e.WriteBacklinks(); err != nil {
+			return util.MakeError(err, "BackfillBacklinks")
+		}
+	}
+
+	return nil
+}
+
+// GetBacklinks returns the posts quoting obj, oldest first, with the thread
+// they are in as InReplyTo. Posts waiting for approval are left out until they
+// are approved.
+func (obj ObjectBase) GetBacklinks() ([]ObjectBase, error) {
+	var backlinks []ObjectBase
+
+	query := `select backlinks.backlink, coalesce((select content from activitystream where id=backlinks.backlink), (select content from cacheactivitystream where id=backlinks.backlink), ''), coalesce(min(op.id), '') from backlinks left join replies reply on reply.id=backlinks.backlink left join replies op on op.id=reply.inreplyto and op.inreplyto='' where backlinks.id=$1 and backlinks.backlink not in (select id from pending) group by backlinks.backlink, backlinks.published order by backlinks.published asc`
+	rows, err := config.DB.Query(query, obj.Id)
+
+	if err != nil {
+		return backlinks, util.MakeError(err, "GetBacklinks")
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var backlink ObjectBase
+		var op ObjectBase
+
+		if err := rows.Scan(&backlink.Id, &backlink.Content, &op.Id); err != nil {
+			return backlinks, util.MakeError(err, "GetBacklinks")
+		}
+
+		if op.Id != "" {
+			backlink.InReplyTo = []ObjectBase{op}
+		}
+
+		backlinks = append(backlinks, backlink)
+	}
+
+	return backlinks, nil
+}
+
+// DeleteBacklinks removes the backlinks written by obj.
+func (obj ObjectBase) DeleteBacklinks() error {
+	query := `delete from backlinks where backlink=$1`
+	_, err := config.DB.Exec(query, obj.Id)
+
+	return util.MakeError(err, "DeleteBacklinks")
+}
+
+// DeleteAllBacklinks removes the backlinks written by obj and those to it.
+func (obj ObjectBase) DeleteAllBacklinks() error {
+	query := `delete from backlinks where id=$1 or backlink=$1`
+	_, err := config.DB.Exec(query, obj.Id)
+
+	return util.MakeError(err, "DeleteAllBacklinks")
+}
@@ -0,0 +1,84 @@
+package activitypub
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/FChannel0/FChannel-Server/util"
+)
+
+// Capcoded posts carry a tag signed by the board actor so other instances
+// can tell a post made by staff of the board from a forged tripcode.
+
+// CapcodeType is the type of the tag holding the capcode of a staff post. Its
+// href is the board actor and its content the signature of the board.
+const CapcodeType = "Capcode"
+
+func capcodeSignature(id string, capcode string) string {
+	return "capcode: " + id + " " + capcode
+}
+
+// SignCapcode returns the capcode tag for obj signed with the key of actor.
+func (obj ObjectBase) SignCapcode(actor Actor) (ObjectBase, error) {
+	var tag ObjectBase
+
+	signature, err := actor.ActivitySign(capcodeSignature(obj.Id, obj.TripCode))
+
+	if err != nil {
+		return tag, util.MakeError(err, "SignCapcode")
+	}
+
+	tag.Type = CapcodeType
+	tag.Name = obj.TripCode
+	tag.Href = actor.Id
+	tag.Content = signature
+
+	return tag, nil
+}
+
+// VerifyCapcode checks the capcode tag of obj was signed by the board the
+// post was made on.
+func (obj ObjectBase) VerifyCapcode() error {
+	for _, e := range obj.Tag {
+		if e.Type != CapcodeType {
+			continue
+		}
+
+		if e.Name != obj.TripCode || e.Href != obj.Actor {
+			return util.MakeError(errors.New("capcode does not match the post"), "VerifyCapcode")
+		}
+
+		actor, err := FingerActor(e.Href)
+
+		if err != nil {
+			return util.MakeError(err, "VerifyCapcode")
+		}
+
+		return util.MakeError(actor.Verify(e.Content, capcodeSignature(obj.Id, obj.TripCode)), "VerifyCapcode")
+	}
+
+	return util.MakeError(errors.New("no capcode tag"), "VerifyCapcode")
+}
+
+// CheckCapcode returns obj with its capcode and capcode tag removed unless
+// the capcode was signed by the board.
+func (obj ObjectBase) CheckCapcode() ObjectBase {
+	if strings.HasPrefix(obj.TripCode, "#") {
+		if err := obj.VerifyCapcode(); err == nil {
+			return obj
+		}
+
+		obj.TripCode = ""
+	}
+
+	var tags []ObjectBase
+	for _, e := range obj.Tag {
+		if e.Type != CapcodeType {
+			tags = append(tags, e)
+		}
+	}
+
+	obj.Tag = tags
+
+	return obj
+}
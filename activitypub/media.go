@@ -0,0 +1,322 @@
+package activitypub
+
+import (
+	"mime"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/FChannel0/FChannel-Server/config"
+	"github.com/FChannel0/FChannel-Server/storage"
+	"github.com/FChannel0/FChannel-Server/util"
+)
+
+// Uploaded files are stored once per content hash and shared between every
+// attachment that references them. refcount tracks the number of attachments
+// using the file, and uploads that are being posted, so it is only removed when
+// the last one is deleted.
+
+// ReserveMedia takes a reference to the stored file with the given content
+// hash, recording href for it if the hash is new. It returns the href of the
+// file and if the upload still has to be stored there. The reference is held
+// while the upload is posted and dropped with ReleaseMedia afterwards, so the
+// file can't be removed before the attachment references it.
+func ReserveMedia(hash string, href string) (string, bool, error) {
+	var stored string
+	var inserted bool
+
+	query := `insert into mediafiles (hash, href, refcount) values ($1, $2, 1) on conflict (hash) do update set refcount=mediafiles.refcount+1 returning href, xmax=0`
+	if err := config.DB.QueryRow(query, hash, href).Scan(&stored, &inserted); err != nil {
+		return "", false, util.MakeError(err, "ReserveMedia")
+	}
+
+	if inserted {
+		return href, true, nil
+	}
+
+	exists, err := storage.Exists(stored)
+
+	if err != nil {
+		ReleaseMedia(stored)
+		return "", false, util.MakeError(err, "ReserveMedia")
+	}
+
+	if exists {
+		return stored, false, nil
+	}
+
+	// the file is stored again and the row pointed at it, its references are kept
+	query = `update mediafiles set href=$2, preview='', fallback='', width=0, height=0, duration='', blurhash='' where hash=$1`
+	if _, err := config.DB.Exec(query, hash, href); err != nil {
+		ReleaseMedia(stored)
+		return "", false, util.MakeError(err, "ReserveMedia")
+	}
+
+	return href, true, nil
+}
+
+func (obj ObjectBase) SetMediaPreview(preview string) error {
+	query := `update mediafiles set preview=$1 where href=$2`
+	_, err := config.DB.Exec(query, preview, obj.Href)
+
+	return util.MakeError(err, "SetMediaPreview")
+}
+
+// GetMediaPreview returns a preview object for the stored file shared by
+// this attachment.
+func (obj ObjectBase) GetMediaPreview() *NestedObjectBase {
+	var nPreview NestedObjectBase
+	var href string
+
+	query := `select preview from mediafiles where href=$1`
+	if err := config.DB.QueryRow(query, obj.Href).Scan(&href); err != nil || href == "" {
+		return &nPreview
+	}
+
+	nPreview.Type = "Preview"
+	nPreview.Name = obj.Name
+	nPreview.Href = href
+	nPreview.MediaType = obj.MediaType
+	nPreview.Size = obj.Size
+	nPreview.Published = obj.Published
+
+	return &nPreview
+}
+
+func (obj ObjectBase) AddMediaReference() error {
+	query := `update mediafiles set refcount=refcount+1 where href=$1`
+	_, err := config.DB.Exec(query, obj.Href)
+
+	return util.MakeError(err, "AddMediaReference")
+}
+
+// ReleaseMedia drops a reference to the stored file at href and removes the
+// file, its preview and fallback once nothing references it. It returns false if href
+// is not a stored file.
+func ReleaseMedia(href string) (bool, error) {
+	var refcount int
+	var preview string
+	var fallback string
+
+	query := `update mediafiles set refcount=refcount-1 where href=$1 returning refcount, preview, fallback`
+	if err := config.DB.QueryRow(query, href).Scan(&refcount, &preview, &fallback); err != nil {
+		return false, nil
+	}
+
+	if refcount > 0 {
+		return true, nil
+	}
+
+	// the row stays locked until the files are gone so an upload reserving
+	// the same hash waits for it and stores the file again
+	tx, err := config.DB.Begin()
+
+	if err != nil {
+		return true, util.MakeError(err, "ReleaseMedia")
+	}
+
+	defer tx.Rollback()
+
+	query = `delete from mediafiles where href=$1 and refcount<1`
+	res, err := tx.Exec(query, href)
+
+	if err != nil {
+		return true, util.MakeError(err, "ReleaseMedia")
+	}
+
+	// referenced again since
+	if n, _ := res.RowsAffected(); n == 0 {
+		return true, nil
+	}
+
+	for _, e := range []string{href, preview, fallback} {
+		if err := storage.Delete(e); err != nil {
+			return true, util.MakeError(err, "ReleaseMedia")
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return true, util.MakeError(err, "ReleaseMedia")
+	}
+
+	return true, nil
+}
+
+// DiscardMedia removes the stored file at href, its preview and fallback if no
+// attachment references it, such as when the post it was uploaded with is
+// rejected.
+func DiscardMedia(href string) error {
+	var preview string
+	var fallback string
+
+	query := `delete from mediafiles where href=$1 and refcount<1 returning preview, fallback`
+	if err := config.DB.QueryRow(query, href).Scan(&preview, &fallback); err != nil {
+		return nil
+	}
+
+	for _, e := range []string{href, preview, fallback} {
+		if err := storage.Delete(e); err != nil {
+			return util.MakeError(err, "DiscardMedia")
+		}
+	}
+
+	return nil
+}
+
+// IsMediaPreview reports if href is the shared preview of a stored file, these
+// are removed along with the file by ReleaseMedia.
+func IsMediaPreview(href string) bool {
+	var hash string
+
+	query := `select hash from mediafiles where preview=$1`
+	if err := config.DB.QueryRow(query, href).Scan(&hash); err != nil {
+		return false
+	}
+
+	return true
+}
+
+// GetMediaReferences returns the local posts with an attachment sharing the
+// file at href.
+func GetMediaReferences(href string) ([]ObjectBase, error) {
+	var posts []ObjectBase
+
+	query := `select id, actor from activitystream where attachment in (select id from activitystream where href=$1)`
+	rows, err := config.DB.Query(query, href)
+
+	if err != nil {
+		return posts, util.MakeError(err, "GetMediaReferences")
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var post ObjectBase
+
+		if err := rows.Scan(&post.Id, &post.Actor); err != nil {
+			return posts, util.MakeError(err, "GetMediaReferences")
+		}
+
+		posts = append(posts, post)
+	}
+
+	return posts, nil
+}
+
+// NeedsFallback reports if mediatype is an image format many browsers can not
+// display, these are stored with a converted copy in config.FallbackFormat.
+func NeedsFallback(mediatype string) bool {
+	return mediatype == "image/jxl" || mediatype == "image/avif"
+}
+
+// FallbackUrl returns the url list of an attachment with a fallback rendition
+// at href, empty if there is none.
+func FallbackUrl(href string) []ObjectBase {
+	if href == "" {
+		return nil
+	}
+
+	var link ObjectBase
+	link.Type = "Link"
+	link.Href = href
+	link.MediaType = mime.TypeByExtension(path.Ext(href))
+
+	return []ObjectBase{link}
+}
+
+// GetFallback returns the href of the widely supported rendition listed in the
+// attachment url, or an empty string if there is none.
+func (obj ObjectBase) GetFallback() string {
+	for _, e := range obj.Url {
+		if e.Href != "" && e.Href != obj.Href && e.MediaType != obj.MediaType && !NeedsFallback(e.MediaType) {
+			return e.Href
+		}
+	}
+
+	return ""
+}
+
+// CreateFallback converts the local file src of the attachment to
+// config.FallbackFormat and puts it in storage. It returns the converted local
+// file, for the caller to create previews from and remove, and its href.
+func (obj ObjectBase) CreateFallback(src string) (string, string, error) {
+	format := config.FallbackFormat
+
+	tempFile, err := os.CreateTemp("", "fchan-*."+format)
+	if err != nil {
+		return "", "", util.MakeError(err, "CreateFallback")
+	}
+
+	tempFile.Close()
+
+	if err := exec.Command("convert", src, "-strip", tempFile.Name()).Run(); err != nil {
+		// not every ImageMagick build has the jxl and avif delegates, try the reference decoders
+		os.Remove(tempFile.Name())
+
+		format = "png"
+		if tempFile, err = os.CreateTemp("", "fchan-*.png"); err != nil {
+			return "", "", util.MakeError(err, "CreateFallback")
+		}
+
+		tempFile.Close()
+
+		var cmd *exec.Cmd
+		switch obj.MediaType {
+		case "image/jxl":
+			cmd = exec.Command("djxl", src, tempFile.Name())
+		default:
+			cmd = exec.Command("avifdec", src, tempFile.Name())
+		}
+
+		if err := cmd.Run(); err != nil {
+			os.Remove(tempFile.Name())
+			return "", "", util.MakeError(err, "CreateFallback")
+		}
+	}
+
+	name := storage.Name(obj.Href)
+	name = strings.TrimSuffix(name, path.Ext(name)) + "-fallback." + format
+
+	if err := storage.Store.Put(name, tempFile.Name(), mime.TypeByExtension("."+format)); err != nil {
+		os.Remove(tempFile.Name())
+		return "", "", util.MakeError(err, "CreateFallback")
+	}
+
+	return tempFile.Name(), storage.Href(name), nil
+}
+
+func (obj ObjectBase) SetMediaFallback(fallback string) error {
+	query := `update mediafiles set fallback=$1 where href=$2`
+	_, err := config.DB.Exec(query, fallback, obj.Href)
+
+	return util.MakeError(err, "SetMediaFallback")
+}
+
+func (obj ObjectBase) GetMediaFallback() string {
+	var href string
+
+	query := `select fallback from mediafiles where href=$1`
+	if err := config.DB.QueryRow(query, obj.Href).Scan(&href); err != nil {
+		return ""
+	}
+
+	return href
+}
+
+// SetMediaInfo stores the dimensions, duration and blurhash of the attachment
+// with its file so later uploads of the same file can reuse them.
+func (obj ObjectBase) SetMediaInfo() error {
+	query := `update mediafiles set width=$1, height=$2, duration=$3, blurhash=$4 where href=$5`
+	_, err := config.DB.Exec(query, obj.Width, obj.Height, obj.Duration, obj.Blurhash, obj.Href)
+
+	return util.MakeError(err, "SetMediaInfo")
+}
+
+// GetMediaInfo returns the attachment with the dimensions, duration and
+// blurhash stored with its file.
+func (obj ObjectBase) GetMediaInfo() ObjectBase {
+	query := `select coalesce(width, 0), coalesce(height, 0), coalesce(duration, ''), coalesce(blurhash, '') from mediafiles where href=$1`
+	config.DB.QueryRow(query, obj.Href).Scan(&obj.Width, &obj.Height, &obj.Duration, &obj.Blurhash)
+
+	return obj
+}
@@ -5,15 +5,18 @@ import (
 	"database/sql"
 	"encoding/base64"
 	"fmt"
+	"mime"
 	"net/smtp"
 	"os"
 	"os/exec"
+	"path"
 	"regexp"
 	"sort"
 	"strings"
 	"time"
 
 	"github.com/FChannel0/FChannel-Server/config"
+	"github.com/FChannel0/FChannel-Server/storage"
 	"github.com/FChannel0/FChannel-Server/util"
 )
 
@@ -100,7 +103,10 @@ func (obj ObjectBase) GetOP() (string, error) {
 	return id, nil
 }
 
-func (obj ObjectBase) CreatePreview() *NestedObjectBase {
+// CreatePreview resizes the local file src of the attachment and puts the
+// result in storage. For formats that need a fallback src is the fallback
+// rendition and the preview uses its format.
+func (obj ObjectBase) CreatePreview(src string) *NestedObjectBase {
 	var nPreview NestedObjectBase
 
 	re := regexp.MustCompile(`/.+$`)
@@ -112,24 +118,37 @@ func (obj ObjectBase) CreatePreview() *NestedObjectBase {
 
 	re = regexp.MustCompile(`.+/`)
 	file := re.ReplaceAllString(obj.MediaType, "")
-	href := util.GetUniqueFilename(file)
+	nPreview.MediaType = obj.MediaType
+
+	if NeedsFallback(obj.MediaType) {
+		file = strings.TrimPrefix(path.Ext(src), ".")
+		nPreview.MediaType = mime.TypeByExtension(path.Ext(src))
+	}
+
+	name := storage.Name(obj.Href)
+	name = strings.TrimSuffix(name, path.Ext(name)) + "-preview." + file
 
 	nPreview.Type = "Preview"
 	nPreview.Name = obj.Name
-	nPreview.Href = config.Domain + "" + href
-	nPreview.MediaType = obj.MediaType
+	nPreview.Href = storage.Href(name)
 	nPreview.Size = obj.Size
 	nPreview.Published = obj.Published
 
-	re = regexp.MustCompile(`/public/.+`)
-	objFile := re.FindString(obj.Href)
+	tempFile, err := os.CreateTemp("", "fchan-*."+file)
+	if err != nil {
+		var preview NestedObjectBase
+		return &preview
+	}
+
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
 
 	var cmd *exec.Cmd
 	switch obj.MediaType {
-	case "image/gif": 
-		cmd = exec.Command("convert", "."+objFile, "-coalesce", "-scale", "250x250>", "+dither", "-remap", "."+objFile+"[0]", "-layers", "Optimize", "-strip", "."+href)
+	case "image/gif":
+		cmd = exec.Command("convert", src, "-coalesce", "-scale", "250x250>", "+dither", "-remap", src+"[0]", "-layers", "Optimize", "-strip", tempFile.Name())
 	default:
-		cmd = exec.Command("convert", "."+objFile, "-resize", "250x250>", "-strip", "."+href)
+		cmd = exec.Command("convert", src, "-resize", "250x250>", "-strip", tempFile.Name())
 	}
 
 	if err := cmd.Run(); err != nil {
@@ -138,6 +157,12 @@ func (obj ObjectBase) CreatePreview() *NestedObjectBase {
 		return &preview
 	}
 
+	if err := storage.Store.Put(name, tempFile.Name(), nPreview.MediaType); err != nil {
+		config.Log.Println(err)
+		var preview NestedObjectBase
+		return &preview
+	}
+
 	return &nPreview
 }
 
@@ -199,12 +224,13 @@ func (obj ObjectBase) DeleteAttachmentFromFile() error {
 		return nil
 	}
 
-	href = strings.Replace(href, config.Domain+"/", "", 1)
-	if href != "static/notfound.png" {
-		if _, err := os.Stat(href); err != nil {
-			return nil
-		}
-		return os.Remove(href)
+	if stored, err := ReleaseMedia(href); stored || err != nil {
+		return util.MakeError(err, "DeleteAttachmentFromFile")
+	}
+
+	if href != config.Domain+"/static/notfound.png" {
+		err := storage.Delete(href)
+		return util.MakeError(err, "DeleteAttachmentFromFile")
 	}
 
 	return nil
@@ -232,12 +258,13 @@ func (obj ObjectBase) DeletePreviewFromFile() error {
 		return nil
 	}
 
-	href = strings.Replace(href, config.Domain+"/", "", 1)
-	if href != "static/notfound.png" {
-		if _, err := os.Stat(href); err != nil {
-			return nil
-		}
-		return os.Remove(href)
+	if IsMediaPreview(href) {
+		return nil
+	}
+
+	if href != config.Domain+"/static/notfound.png" {
+		err := storage.Delete(href)
+		return util.MakeError(err, "DeletePreviewFromFile")
 	}
 
 	return nil
@@ -278,6 +305,18 @@ func (obj ObjectBase) Delete() error {
 		return util.MakeError(err, "Delete")
 	}
 
+	if err := obj.DeleteTags(); err != nil {
+		return util.MakeError(err, "Delete")
+	}
+
+	if err := obj.DeleteAllBacklinks(); err != nil {
+		return util.MakeError(err, "Delete")
+	}
+
+	if err := obj.DeletePoll(); err != nil {
+		return util.MakeError(err, "Delete")
+	}
+
 	query = `delete from cacheactivitystream where id=$1`
 	_, err := config.DB.Exec(query, obj.Id)
 	return util.MakeError(err, "Delete")
@@ -354,7 +393,7 @@ func (obj ObjectBase) GetCollectionLocal() (Collection, error) {
 	var rows *sql.Rows
 	var err error
 
-	query := `select x.id, x.name, x.alias, x.content, x.type, x.published, x.updated, x.attributedto, x.attachment, x.preview, x.actor, x.tripcode, x.sensitive from (select id, name, alias, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive from activitystream where id=$1 and (type='Note' or type='Archive') union select id, name, alias, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive from cacheactivitystream where id=$1 and (type='Note' or type='Archive')) as x`
+	query := `select x.id, x.name, x.alias, x.content, x.type, x.published, x.updated, x.attributedto, x.attachment, x.preview, x.actor, x.tripcode, x.sensitive, x.posterid from (select id, name, alias, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive, posterid from activitystream where id=$1 and (type='Note' or type='Archive') union select id, name, alias, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive, posterid from cacheactivitystream where id=$1 and (type='Note' or type='Archive')) as x`
 	if rows, err = config.DB.Query(query, obj.Id); err != nil {
 		return nColl, util.MakeError(err, "GetCollectionLocal")
 	}
@@ -370,7 +409,7 @@ func (obj ObjectBase) GetCollectionLocal() (Collection, error) {
 		var prev NestedObjectBase
 		post.Preview = &prev
 
-		err = rows.Scan(&post.Id, &post.Name, &post.Alias, &post.Content, &post.Type, &post.Published, &post.Updated, &post.AttributedTo, &post.Attachment[0].Id, &post.Preview.Id, &actor.Id, &post.TripCode, &post.Sensitive)
+		err = rows.Scan(&post.Id, &post.Name, &post.Alias, &post.Content, &post.Type, &post.Published, &post.Updated, &post.AttributedTo, &post.Attachment[0].Id, &post.Preview.Id, &actor.Id, &post.TripCode, &post.Sensitive, &post.PosterId)
 
 		if err != nil {
 			return nColl, util.MakeError(err, "GetCollectionLocal")
@@ -403,6 +442,10 @@ func (obj ObjectBase) GetCollectionLocal() (Collection, error) {
 			return nColl, util.MakeError(err, "GetCollectionLocal")
 		}
 
+		post.Tag, _ = post.GetTags()
+		post.Backlinks, _ = post.GetBacklinks()
+		post, _ = post.GetPoll()
+
 		if post.Preview, err = post.Preview.GetPreview(); err != nil {
 			return nColl, util.MakeError(err, "GetCollectionLocal")
 		}
@@ -447,9 +490,12 @@ func (obj ObjectBase) GetAttachment() ([]ObjectBase, error) {
 	var attachments []ObjectBase
 	var attachment ObjectBase
 
-	query := `select x.id, x.type, x.name, x.href, x.mediatype, x.size, x.published from (select id, type, name, href, mediatype, size, published from activitystream where id=$1 union select id, type, name, href, mediatype, size, published from cacheactivitystream where id=$1) as x`
-	_ = config.DB.QueryRow(query, obj.Id).Scan(&attachment.Id, &attachment.Type, &attachment.Name, &attachment.Href, &attachment.MediaType, &attachment.Size, &attachment.Published)
+	var fallback string
+
+	query := `select x.id, x.type, x.name, x.href, x.mediatype, x.size, x.published, x.fallback, x.width, x.height, x.duration, x.blurhash from (select id, type, name, href, mediatype, size, published, fallback, coalesce(width, 0) as width, coalesce(height, 0) as height, coalesce(duration, '') as duration, coalesce(blurhash, '') as blurhash from activitystream where id=$1 union select id, type, name, href, mediatype, size, published, fallback, coalesce(width, 0) as width, coalesce(height, 0) as height, coalesce(duration, '') as duration, coalesce(blurhash, '') as blurhash from cacheactivitystream where id=$1) as x`
+	_ = config.DB.QueryRow(query, obj.Id).Scan(&attachment.Id, &attachment.Type, &attachment.Name, &attachment.Href, &attachment.MediaType, &attachment.Size, &attachment.Published, &fallback, &attachment.Width, &attachment.Height, &attachment.Duration, &attachment.Blurhash)
 
+	attachment.Url = FallbackUrl(fallback)
 	attachments = append(attachments, attachment)
 	return attachments, nil
 }
@@ -469,8 +515,8 @@ func (obj ObjectBase) GetCollectionFromPath() (Collection, error) {
 
 	var err error
 
-	query := `select x.id, x.name, x.alias, x.content, x.type, x.published, x.updated, x.attributedto, x.attachment, x.preview, x.actor, x.tripcode, x.sensitive from (select id, name, alias, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive from activitystream where id like $1 and (type='Note' or type='Archive') union select id, name, alias, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive from cacheactivitystream where id like $1 and (type='Note' or type='Archive')) as x order by x.updated`
-	if err = config.DB.QueryRow(query, obj.Id).Scan(&post.Id, &post.Name, &post.Alias, &post.Content, &post.Type, &post.Published, &post.Updated, &post.AttributedTo, &post.Attachment[0].Id, &post.Preview.Id, &actor.Id, &post.TripCode, &post.Sensitive); err != nil {
+	query := `select x.id, x.name, x.alias, x.content, x.type, x.published, x.updated, x.attributedto, x.attachment, x.preview, x.actor, x.tripcode, x.sensitive, x.posterid from (select id, name, alias, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive, posterid from activitystream where id like $1 and (type='Note' or type='Archive') union select id, name, alias, content, type, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive, posterid from cacheactivitystream where id like $1 and (type='Note' or type='Archive')) as x order by x.updated`
+	if err = config.DB.QueryRow(query, obj.Id).Scan(&post.Id, &post.Name, &post.Alias, &post.Content, &post.Type, &post.Published, &post.Updated, &post.AttributedTo, &post.Attachment[0].Id, &post.Preview.Id, &actor.Id, &post.TripCode, &post.Sensitive, &post.PosterId); err != nil {
 		return nColl, nil
 	}
 
@@ -491,6 +537,10 @@ func (obj ObjectBase) GetCollectionFromPath() (Collection, error) {
 		return nColl, util.MakeError(err, "GetCollectionFromPath")
 	}
 
+	post.Tag, _ = post.GetTags()
+	post.Backlinks, _ = post.GetBacklinks()
+	post, _ = post.GetPoll()
+
 	if post.Preview, err = post.Preview.GetPreview(); err != nil {
 		return nColl, util.MakeError(err, "GetCollectionFromPath")
 	}
@@ -545,6 +595,10 @@ func (obj ObjectBase) GetFromPath() (ObjectBase, error) {
 		return post, util.MakeError(err, "GetFromPath")
 	}
 
+	post.Tag, _ = post.GetTags()
+	post.Backlinks, _ = post.GetBacklinks()
+	post, _ = post.GetPoll()
+
 	post.Preview, err = post.Preview.GetPreview()
 	return post, util.MakeError(err, "GetFromPath")
 }
@@ -581,7 +635,7 @@ func (obj ObjectBase) GetReplies() (CollectionBase, int, int, error) {
 	var rows *sql.Rows
 	var err error
 
-	query := `select count(x.id) over(), sum(case when RTRIM(x.attachment) = '' then 0 else 1 end) over(), x.id, x.name, x.alias, x.content, x.type, x.published, x.attributedto, x.attachment, x.preview, x.actor, x.tripcode, x.sensitive from (select * from activitystream where id in (select id from replies where inreplyto=$1) and (type='Note' or type='Archive') union select * from cacheactivitystream where id in (select id from replies where inreplyto=$1) and (type='Note' or type='Archive')) as x order by x.published asc`
+	query := `select count(x.id) over(), sum(case when RTRIM(x.attachment) = '' then 0 else 1 end) over(), x.id, x.name, x.alias, x.content, x.type, x.published, x.attributedto, x.attachment, x.preview, x.actor, x.tripcode, x.sensitive, x.posterid from (select * from activitystream where id in (select id from replies where inreplyto=$1) and (type='Note' or type='Archive') union select * from cacheactivitystream where id in (select id from replies where inreplyto=$1) and (type='Note' or type='Archive')) as x order by x.published asc`
 	if rows, err = config.DB.Query(query, obj.Id); err != nil {
 		return nColl, postCount, attachCount, util.MakeError(err, "GetReplies")
 	}
@@ -597,7 +651,7 @@ func (obj ObjectBase) GetReplies() (CollectionBase, int, int, error) {
 		var prev NestedObjectBase
 		post.Preview = &prev
 
-		err = rows.Scan(&postCount, &attachCount, &post.Id, &post.Name, &post.Alias, &post.Content, &post.Type, &post.Published, &post.AttributedTo, &post.Attachment[0].Id, &post.Preview.Id, &actor.Id, &post.TripCode, &post.Sensitive)
+		err = rows.Scan(&postCount, &attachCount, &post.Id, &post.Name, &post.Alias, &post.Content, &post.Type, &post.Published, &post.AttributedTo, &post.Attachment[0].Id, &post.Preview.Id, &actor.Id, &post.TripCode, &post.Sensitive, &post.PosterId)
 
 		if err != nil {
 			return nColl, postCount, attachCount, util.MakeError(err, "GetReplies")
@@ -619,6 +673,10 @@ func (obj ObjectBase) GetReplies() (CollectionBase, int, int, error) {
 			return nColl, postCount, attachCount, util.MakeError(err, "GetReplies")
 		}
 
+		post.Tag, _ = post.GetTags()
+		post.Backlinks, _ = post.GetBacklinks()
+		post, _ = post.GetPoll()
+
 		post.Preview, err = post.Preview.GetPreview()
 
 		if err != nil {
@@ -643,7 +701,7 @@ func (obj ObjectBase) GetRepliesLimit(limit int) (CollectionBase, int, int, erro
 	var rows *sql.Rows
 	var err error
 
-	query := `select count(x.id) over(), sum(case when RTRIM(x.attachment) = '' then 0 else 1 end) over(), x.id, x.name, x.alias, x.content, x.type, x.published, x.attributedto, x.attachment, x.preview, x.actor, x.tripcode, x.sensitive from (select * from activitystream where id in (select id from replies where inreplyto=$1) and type='Note' union select * from cacheactivitystream where id in (select id from replies where inreplyto=$1) and type='Note') as x order by x.published desc limit $2`
+	query := `select count(x.id) over(), sum(case when RTRIM(x.attachment) = '' then 0 else 1 end) over(), x.id, x.name, x.alias, x.content, x.type, x.published, x.attributedto, x.attachment, x.preview, x.actor, x.tripcode, x.sensitive, x.posterid from (select * from activitystream where id in (select id from replies where inreplyto=$1) and type='Note' union select * from cacheactivitystream where id in (select id from replies where inreplyto=$1) and type='Note') as x order by x.published desc limit $2`
 	if rows, err = config.DB.Query(query, obj.Id, limit); err != nil {
 		return nColl, postCount, attachCount, util.MakeError(err, "GetRepliesLimit")
 	}
@@ -659,7 +717,7 @@ func (obj ObjectBase) GetRepliesLimit(limit int) (CollectionBase, int, int, erro
 		var prev NestedObjectBase
 		post.Preview = &prev
 
-		err = rows.Scan(&postCount, &attachCount, &post.Id, &post.Name, &post.Alias, &post.Content, &post.Type, &post.Published, &post.AttributedTo, &post.Attachment[0].Id, &post.Preview.Id, &actor.Id, &post.TripCode, &post.Sensitive)
+		err = rows.Scan(&postCount, &attachCount, &post.Id, &post.Name, &post.Alias, &post.Content, &post.Type, &post.Published, &post.AttributedTo, &post.Attachment[0].Id, &post.Preview.Id, &actor.Id, &post.TripCode, &post.Sensitive, &post.PosterId)
 
 		if err != nil {
 			return nColl, postCount, attachCount, util.MakeError(err, "GetRepliesLimit")
@@ -681,6 +739,10 @@ func (obj ObjectBase) GetRepliesLimit(limit int) (CollectionBase, int, int, erro
 			return nColl, postCount, attachCount, util.MakeError(err, "GetRepliesLimit")
 		}
 
+		post.Tag, _ = post.GetTags()
+		post.Backlinks, _ = post.GetBacklinks()
+		post, _ = post.GetPoll()
+
 		post.Preview, err = post.Preview.GetPreview()
 
 		if err != nil {
@@ -707,7 +769,7 @@ func (obj ObjectBase) GetRepliesReplies() (CollectionBase, int, int, error) {
 	var err error
 	var rows *sql.Rows
 
-	query := `select count(x.id) over(), sum(case when RTRIM(x.attachment) = '' then 0 else 1 end) over(), x.id, x.name, x.alias, x.content, x.type, x.published, x.attributedto, x.attachment, x.preview, x.actor, x.tripcode, x.sensitive from (select * from activitystream where id in (select id from replies where inreplyto=$1) and (type='Note' or type='Archive') union select * from cacheactivitystream where id in (select id from replies where inreplyto=$1) and (type='Note' or type='Archive')) as x order by x.published asc`
+	query := `select count(x.id) over(), sum(case when RTRIM(x.attachment) = '' then 0 else 1 end) over(), x.id, x.name, x.alias, x.content, x.type, x.published, x.attributedto, x.attachment, x.preview, x.actor, x.tripcode, x.sensitive, x.posterid from (select * from activitystream where id in (select id from replies where inreplyto=$1) and (type='Note' or type='Archive') union select * from cacheactivitystream where id in (select id from replies where inreplyto=$1) and (type='Note' or type='Archive')) as x order by x.published asc`
 	if rows, err = config.DB.Query(query, obj.Id); err != nil {
 		return nColl, postCount, attachCount, util.MakeError(err, "GetRepliesReplies")
 	}
@@ -724,7 +786,7 @@ func (obj ObjectBase) GetRepliesReplies() (CollectionBase, int, int, error) {
 		var prev NestedObjectBase
 		post.Preview = &prev
 
-		err = rows.Scan(&postCount, &attachCount, &post.Id, &post.Name, &post.Alias, &post.Content, &post.Type, &post.Published, &post.AttributedTo, &post.Attachment[0].Id, &post.Preview.Id, &actor.Id, &post.TripCode, &post.Sensitive)
+		err = rows.Scan(&postCount, &attachCount, &post.Id, &post.Name, &post.Alias, &post.Content, &post.Type, &post.Published, &post.AttributedTo, &post.Attachment[0].Id, &post.Preview.Id, &actor.Id, &post.TripCode, &post.Sensitive, &post.PosterId)
 		if err != nil {
 			return nColl, postCount, attachCount, util.MakeError(err, "GetRepliesReplies")
 		}
@@ -739,6 +801,10 @@ func (obj ObjectBase) GetRepliesReplies() (CollectionBase, int, int, error) {
 			return nColl, postCount, attachCount, util.MakeError(err, "GetRepliesReplies")
 		}
 
+		post.Tag, _ = post.GetTags()
+		post.Backlinks, _ = post.GetBacklinks()
+		post, _ = post.GetPoll()
+
 		post.Preview, err = post.Preview.GetPreview()
 
 		if err != nil {
@@ -932,12 +998,12 @@ func (obj ObjectBase) _SetRepliesType(_type string) error {
 func (obj ObjectBase) TombstoneAttachment() error {
 	datetime := time.Now().UTC().Format(time.RFC3339)
 
-	query := `update activitystream set type='Tombstone', mediatype='image/png', href=$1, name='', content='', attributedto='deleted', deleted=$2 where id in (select attachment from activitystream where id=$3)`
+	query := `update activitystream set type='Tombstone', mediatype='image/png', href=$1, fallback='', width=0, height=0, duration='', blurhash='', name='', content='', attributedto='deleted', deleted=$2 where id in (select attachment from activitystream where id=$3)`
 	if _, err := config.DB.Exec(query, config.Domain+"/static/notfound.png", datetime, obj.Id); err != nil {
 		return util.MakeError(err, "_SetRepliesType")
 	}
 
-	query = `update cacheactivitystream set type='Tombstone', mediatype='image/png', href=$1, name='', content='', attributedto='deleted', deleted=$2 where id in (select attachment from cacheactivitystream where id=$3)`
+	query = `update cacheactivitystream set type='Tombstone', mediatype='image/png', href=$1, fallback='', width=0, height=0, duration='', blurhash='', name='', content='', attributedto='deleted', deleted=$2 where id in (select attachment from cacheactivitystream where id=$3)`
 	_, err := config.DB.Exec(query, config.Domain+"/static/notfound.png", datetime, obj.Id)
 	return util.MakeError(err, "_SetRepliesType")
 }
@@ -964,12 +1030,12 @@ func (obj ObjectBase) TombstoneAttachmentReplies() error {
 func (obj ObjectBase) TombstonePreview() error {
 	datetime := time.Now().UTC().Format(time.RFC3339)
 
-	query := `update activitystream set type='Tombstone', mediatype='image/png', href=$1, name='', content='', attributedto='deleted', deleted=$2 where id in (select preview from activitystream where id=$3)`
+	query := `update activitystream set type='Tombstone', mediatype='image/png', href=$1, fallback='', width=0, height=0, duration='', blurhash='', name='', content='', attributedto='deleted', deleted=$2 where id in (select preview from activitystream where id=$3)`
 	if _, err := config.DB.Exec(query, config.Domain+"/static/notfound.png", datetime, obj.Id); err != nil {
 		return util.MakeError(err, "TombstonePreview")
 	}
 
-	query = `update cacheactivitystream set type='Tombstone', mediatype='image/png', href=$1, name='', content='', attributedto='deleted', deleted=$2 where id in (select preview from cacheactivitystream where id=$3)`
+	query = `update cacheactivitystream set type='Tombstone', mediatype='image/png', href=$1, fallback='', width=0, height=0, duration='', blurhash='', name='', content='', attributedto='deleted', deleted=$2 where id in (select preview from cacheactivitystream where id=$3)`
 	_, err := config.DB.Exec(query, config.Domain+"/static/notfound.png", datetime, obj.Id)
 	return util.MakeError(err, "TombstonePreview")
 }
@@ -1020,12 +1086,24 @@ func (obj ObjectBase) Tombstone() error {
 func (obj ObjectBase) _Tombstone() error {
 	datetime := time.Now().UTC().Format(time.RFC3339)
 
-	query := `update activitystream set type='Tombstone', name='', content='', attributedto='deleted', tripcode='', deleted=$1 where id=$2`
+	query := `update activitystream set type='Tombstone', name='', content='', attributedto='deleted', tripcode='', posterid='', deleted=$1 where id=$2`
 	if _, err := config.DB.Exec(query, datetime, obj.Id); err != nil {
 		return util.MakeError(err, "_Tombstone")
 	}
 
-	query = `update cacheactivitystream set type='Tombstone', name='', content='', attributedto='deleted', tripcode='',  deleted=$1 where id=$2`
+	if err := obj.DeleteTags(); err != nil {
+		return util.MakeError(err, "_Tombstone")
+	}
+
+	if err := obj.DeleteAllBacklinks(); err != nil {
+		return util.MakeError(err, "_Tombstone")
+	}
+
+	if err := obj.DeletePoll(); err != nil {
+		return util.MakeError(err, "_Tombstone")
+	}
+
+	query = `update cacheactivitystream set type='Tombstone', name='', content='', attributedto='deleted', tripcode='', posterid='', deleted=$1 where id=$2`
 	_, err := config.DB.Exec(query, datetime, obj.Id)
 	return util.MakeError(err, "_Tombstone")
 }
@@ -1069,12 +1147,29 @@ func (obj ObjectBase) TombstoneReplies() error {
 func (obj ObjectBase) _TombstoneReplies() error {
 	datetime := time.Now().UTC().Format(time.RFC3339)
 
-	query := `update activitystream set type='Tombstone', name='', content='', attributedto='deleted', tripcode='', deleted=$1 where id in (select id from replies where inreplyto=$2)`
+	query := `update activitystream set type='Tombstone', name='', content='', attributedto='deleted', tripcode='', posterid='', deleted=$1 where id in (select id from replies where inreplyto=$2)`
 	if _, err := config.DB.Exec(query, datetime, obj.Id); err != nil {
 		return util.MakeError(err, "_TombstoneReplies")
 	}
 
-	query = `update cacheactivitystream set type='Tombstone', name='', content='', attributedto='deleted', tripcode='', deleted=$1 where id in (select id from replies where inreplyto=$2)`
+	query = `delete from tags where id in (select id from replies where inreplyto=$1)`
+	if _, err := config.DB.Exec(query, obj.Id); err != nil {
+		return util.MakeError(err, "_TombstoneReplies")
+	}
+
+	query = `delete from backlinks where id in (select id from replies where inreplyto=$1) or backlink in (select id from replies where inreplyto=$1)`
+	if _, err := config.DB.Exec(query, obj.Id); err != nil {
+		return util.MakeError(err, "_TombstoneReplies")
+	}
+
+	for _, table := range []string{"pollchoices", "pollvotes", "polls"} {
+		query = `delete from ` + table + ` where id in (select id from replies where inreplyto=$1)`
+		if _, err := config.DB.Exec(query, obj.Id); err != nil {
+			return util.MakeError(err, "_TombstoneReplies")
+		}
+	}
+
+	query = `update cacheactivitystream set type='Tombstone', name='', content='', attributedto='deleted', tripcode='', posterid='', deleted=$1 where id in (select id from replies where inreplyto=$2)`
 	_, err := config.DB.Exec(query, datetime, obj.Id)
 	return util.MakeError(err, "_TombstoneReplies")
 }
@@ -1090,6 +1185,12 @@ func (obj ObjectBase) UpdateType(_type string) error {
 	return util.MakeError(err, "UpdateType")
 }
 
+func (obj ObjectBase) UpdatePosterId() error {
+	query := `update activitystream set posterid=$1 where id=$2`
+	_, err := config.DB.Exec(query, obj.PosterId, obj.Id)
+	return util.MakeError(err, "UpdatePosterId")
+}
+
 func (obj ObjectBase) UpdatePreview(preview string) error {
 	query := `update activitystream set preview=$1 where attachment=$2`
 	_, err := config.DB.Exec(query, preview, obj.Id)
@@ -1169,6 +1270,18 @@ func (obj ObjectBase) Write() (ObjectBase, error) {
 		return obj, util.MakeError(err, "Write")
 	}
 
+	if err := obj.WriteTags(); err != nil {
+		return obj, util.MakeError(err, "Write")
+	}
+
+	if err := obj.WriteBacklinks(); err != nil {
+		return obj, util.MakeError(err, "Write")
+	}
+
+	if err := obj.WritePoll(); err != nil {
+		return obj, util.MakeError(err, "Write")
+	}
+
 	err = obj.WriteWallet()
 	return obj, util.MakeError(err, "Write")
 }
@@ -1179,16 +1292,19 @@ func (obj ObjectBase) _Write() error {
 	obj.AttributedTo = util.EscapeString(obj.AttributedTo)
 	obj.Alias = util.EscapeString(obj.Alias)
 
-	query := `insert into activitystream (id, type, name, alias, content, published, updated, attributedto, actor, tripcode, sensitive) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
-	_, err := config.DB.Exec(query, obj.Id, obj.Type, obj.Name, obj.Alias, obj.Content, obj.Published, obj.Updated, obj.AttributedTo, obj.Actor, obj.TripCode, obj.Sensitive)
+	query := `insert into activitystream (id, type, name, alias, content, published, updated, attributedto, actor, tripcode, sensitive, posterid) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+	_, err := config.DB.Exec(query, obj.Id, obj.Type, obj.Name, obj.Alias, obj.Content, obj.Published, obj.Updated, obj.AttributedTo, obj.Actor, obj.TripCode, obj.Sensitive, obj.PosterId)
 
 	return util.MakeError(err, "_Write")
 }
 
 func (obj ObjectBase) WriteAttachment() error {
-	query := `insert into activitystream (id, type, name, href, published, updated, attributedTo, mediatype, size) values ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
-	_, err := config.DB.Exec(query, obj.Id, obj.Type, obj.Name, obj.Href, obj.Published, obj.Updated, obj.AttributedTo, obj.MediaType, obj.Size)
+	query := `insert into activitystream (id, type, name, href, published, updated, attributedTo, mediatype, size, fallback, width, height, duration, blurhash) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`
+	if _, err := config.DB.Exec(query, obj.Id, obj.Type, obj.Name, obj.Href, obj.Published, obj.Updated, obj.AttributedTo, obj.MediaType, obj.Size, obj.GetFallback(), obj.Width, obj.Height, obj.Duration, obj.Blurhash); err != nil {
+		return util.MakeError(err, "WriteAttachment")
+	}
 
+	err := obj.AddMediaReference()
 	return util.MakeError(err, "WriteAttachment")
 }
 
@@ -1201,8 +1317,17 @@ func (obj ObjectBase) WriteAttachmentCache() error {
 			obj.Updated = obj.Published
 		}
 
-		query = `insert into cacheactivitystream (id, type, name, href, published, updated, attributedTo, mediatype, size) values ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
-		_, err = config.DB.Exec(query, obj.Id, obj.Type, obj.Name, obj.Href, obj.Published, obj.Updated, obj.AttributedTo, obj.MediaType, obj.Size)
+		// remote software may send anything here, keep only values that fit
+		if len(obj.Blurhash) > 100 {
+			obj.Blurhash = ""
+		}
+
+		if len(obj.Duration) > 100 {
+			obj.Duration = ""
+		}
+
+		query = `insert into cacheactivitystream (id, type, name, href, published, updated, attributedTo, mediatype, size, fallback, width, height, duration, blurhash) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`
+		_, err = config.DB.Exec(query, obj.Id, obj.Type, obj.Name, obj.Href, obj.Published, obj.Updated, obj.AttributedTo, obj.MediaType, obj.Size, obj.GetFallback(), obj.Width, obj.Height, obj.Duration, obj.Blurhash)
 		return util.MakeError(err, "WriteAttachmentCache")
 	}
 
@@ -1222,8 +1347,8 @@ func (obj ObjectBase) _WriteCache() error {
 			obj.Updated = obj.Published
 		}
 
-		query = `insert into cacheactivitystream (id, type, name, content, published, updated, attributedto, actor, tripcode, sensitive) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
-		_, err = config.DB.Exec(query, obj.Id, obj.Type, obj.Name, obj.Content, obj.Published, obj.Updated, obj.AttributedTo, obj.Actor, obj.TripCode, obj.Sensitive)
+		query = `insert into cacheactivitystream (id, type, name, content, published, updated, attributedto, actor, tripcode, sensitive, posterid) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+		_, err = config.DB.Exec(query, obj.Id, obj.Type, obj.Name, obj.Content, obj.Published, obj.Updated, obj.AttributedTo, obj.Actor, obj.TripCode, obj.Sensitive, obj.PosterId)
 		return util.MakeError(err, "_WriteCache")
 	}
 
@@ -1243,8 +1368,8 @@ func (obj ObjectBase) WriteCacheWithAttachment(attachment ObjectBase) error {
 			obj.Updated = obj.Published
 		}
 
-		query = `insert into cacheactivitystream (id, type, name, content, attachment, preview, published, updated, attributedto, actor, tripcode, sensitive) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
-		_, err = config.DB.Exec(query, obj.Id, obj.Type, obj.Name, obj.Content, attachment.Id, obj.Preview.Id, obj.Published, obj.Updated, obj.AttributedTo, obj.Actor, obj.TripCode, obj.Sensitive)
+		query = `insert into cacheactivitystream (id, type, name, content, attachment, preview, published, updated, attributedto, actor, tripcode, sensitive, posterid) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`
+		_, err = config.DB.Exec(query, obj.Id, obj.Type, obj.Name, obj.Content, attachment.Id, obj.Preview.Id, obj.Published, obj.Updated, obj.AttributedTo, obj.Actor, obj.TripCode, obj.Sensitive, obj.PosterId)
 		return util.MakeError(err, "WriteCacheWithAttachment")
 	}
 
@@ -1286,7 +1411,7 @@ func (obj ObjectBase) WriteReply() error {
 				return util.MakeError(err, "WriteReply")
 			}
 
-			if nType == "Archive" {
+			if nType == "Archive" && obj.Type != PendingType {
 				if err := obj.UpdateType("Archive"); err != nil {
 					return util.MakeError(err, "WriteReply")
 				}
@@ -1313,7 +1438,8 @@ func (obj ObjectBase) WriteReply() error {
 			}
 		}
 
-		if update {
+		// held posts bump their thread once approved
+		if update && obj.Type != PendingType {
 			if err := e.WriteUpdate(obj.Published); err != nil {
 				return util.MakeError(err, "WriteReply")
 			}
@@ -1341,6 +1467,18 @@ func (obj ObjectBase) WriteCache() (ObjectBase, error) {
 		return obj, util.MakeError(err, "WriteObjectToCache")
 	}
 
+	// remote software may send anything here, keep only values that fit
+	if len(obj.PosterId) > 20 {
+		obj.PosterId = ""
+	}
+
+	obj = obj.CheckCapcode()
+
+	// polls are stored as Notes with their choices beside them
+	if obj.Type == "Question" {
+		obj.Type = "Note"
+	}
+
 	if len(obj.Attachment) > 0 {
 		if obj.Preview.Href != "" {
 			obj.Preview.WritePreviewCache()
@@ -1355,6 +1493,9 @@ func (obj ObjectBase) WriteCache() (ObjectBase, error) {
 	}
 
 	obj.WriteReply()
+	obj.WriteTags()
+	obj.WriteBacklinks()
+	obj.WritePoll()
 
 	if obj.Replies.OrderedItems != nil {
 		for _, e := range obj.Replies.OrderedItems {
@@ -1397,8 +1538,8 @@ func (obj ObjectBase) WriteWithAttachment(attachment ObjectBase) {
 	obj.Content = util.EscapeString(obj.Content)
 	obj.AttributedTo = util.EscapeString(obj.AttributedTo)
 
-	query := `insert into activitystream (id, type, name, alias, content, attachment, preview, published, updated, attributedto, actor, tripcode, sensitive) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`
-	_, e := config.DB.Exec(query, obj.Id, obj.Type, obj.Name, obj.Alias, obj.Content, attachment.Id, obj.Preview.Id, obj.Published, obj.Updated, obj.AttributedTo, obj.Actor, obj.TripCode, obj.Sensitive)
+	query := `insert into activitystream (id, type, name, alias, content, attachment, preview, published, updated, attributedto, actor, tripcode, sensitive, posterid) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`
+	_, e := config.DB.Exec(query, obj.Id, obj.Type, obj.Name, obj.Alias, obj.Content, attachment.Id, obj.Preview.Id, obj.Published, obj.Updated, obj.AttributedTo, obj.Actor, obj.TripCode, obj.Sensitive, obj.PosterId)
 
 	if e != nil {
 		config.Log.Println("error inserting new activity with attachment")
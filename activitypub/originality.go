@@ -0,0 +1,101 @@
+package activitypub
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"html"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/FChannel0/FChannel-Server/config"
+	"github.com/FChannel0/FChannel-Server/util"
+)
+
+// Boards in R9K mode only take posts whose text and files were not posted on
+// the board before. The hashes of everything posted are kept per board, local
+// and remote posts alike.
+
+var originalityQuoteRe = regexp.MustCompile(`>>\S+`)
+var originalityStripRe = regexp.MustCompile(`[^\p{L}\p{N}\s]+`)
+
+// NormalizeText returns content without quotes, punctuation, case and extra
+// whitespace, so trivial changes do not make a post original.
+func NormalizeText(content string) string {
+	content = html.UnescapeString(content)
+	content = originalityQuoteRe.ReplaceAllString(content, "")
+	content = originalityStripRe.ReplaceAllString(strings.ToLower(content), "")
+
+	return strings.Join(strings.Fields(content), " ")
+}
+
+// OriginalityHashes returns the hashes content and the files with the given
+// content hashes are indexed under.
+func OriginalityHashes(content string, media []string) []string {
+	var hashes []string
+
+	if text := NormalizeText(content); text != "" {
+		h := sha256.New()
+		h.Write([]byte(text))
+		hashes = append(hashes, "text:"+hex.EncodeToString(h.Sum(nil)))
+	}
+
+	for _, e := range media {
+		if e != "" {
+			hashes = append(hashes, "media:"+e)
+		}
+	}
+
+	return hashes
+}
+
+// OriginalityHashes returns the hashes of the content and attachments of obj.
+// Files are named after their content hash, so the name of the file stands in
+// for the hash of remote attachments.
+func (obj ObjectBase) OriginalityHashes() []string {
+	var media []string
+
+	for _, e := range obj.Attachment {
+		if e.Href == "" {
+			continue
+		}
+
+		media = append(media, MediaHash(e.Href))
+	}
+
+	return OriginalityHashes(obj.Content, media)
+}
+
+// MediaHash returns the content hash of the file at href, taken from its name.
+func MediaHash(href string) string {
+	name := path.Base(href)
+	return strings.TrimSuffix(name, path.Ext(name))
+}
+
+// IsOriginal returns true if none of hashes were posted on the board before.
+func (actor Actor) IsOriginal(hashes []string) (bool, error) {
+	if len(hashes) == 0 {
+		return true, nil
+	}
+
+	var count int
+
+	query := `select count(*) from originality where actor=$1 and hash = ANY($2)`
+	if err := config.DB.QueryRow(query, actor.Id, hashes).Scan(&count); err != nil {
+		return false, util.MakeError(err, "IsOriginal")
+	}
+
+	return count == 0, nil
+}
+
+// WriteOriginality adds hashes to the posts seen on the board.
+func (actor Actor) WriteOriginality(hashes []string) error {
+	for _, e := range hashes {
+		query := `insert into originality (actor, hash) values ($1, $2) on conflict do nothing`
+		if _, err := config.DB.Exec(query, actor.Id, e); err != nil {
+			return util.MakeError(err, "WriteOriginality")
+		}
+	}
+
+	return nil
+}
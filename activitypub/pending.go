@@ -0,0 +1,245 @@
+package activitypub
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/FChannel0/FChannel-Server/config"
+	"github.com/FChannel0/FChannel-Server/util"
+)
+
+// Posts held for approval are stored with the type Pending, so they stay out
+// of the board, catalog and outbox until a janitor approves them and they are
+// sent to followers. Why a post was held and whether it bumps its thread once
+// approved is kept in the pending table.
+
+const PendingType = "Pending"
+
+// What posts a board holds for approval.
+const (
+	PremodOff     = ""
+	PremodThreads = "threads"
+	PremodAll     = "all"
+)
+
+type PendingPost struct {
+	Object ObjectBase
+	OP     string
+	Reason string
+}
+
+func (actor Actor) GetPremoderation() (string, error) {
+	var mode string
+
+	query := `select premoderation from actor where id=$1`
+	if err := config.DB.QueryRow(query, actor.Id).Scan(&mode); err != nil {
+		return PremodOff, util.MakeError(err, "GetPremoderation")
+	}
+
+	return mode, nil
+}
+
+// SetPremoderation moves the board on from holding nothing, to holding new
+// threads, to holding all posts and back.
+func (actor Actor) SetPremoderation() error {
+	current, err := actor.GetPremoderation()
+
+	if err != nil {
+		return util.MakeError(err, "SetPremoderation")
+	}
+
+	next := PremodThreads
+	switch current {
+	case PremodThreads:
+		next = PremodAll
+	case PremodAll:
+		next = PremodOff
+	}
+
+	query := `update actor set premoderation=$1 where id=$2`
+	_, err = config.DB.Exec(query, next, actor.Id)
+
+	return util.MakeError(err, "SetPremoderation")
+}
+
+// NeedsApproval returns true if obj has to be approved before it is shown on
+// the board.
+func (actor Actor) NeedsApproval(obj ObjectBase) (bool, error) {
+	mode, err := actor.GetPremoderation()
+
+	if err != nil {
+		return false, util.MakeError(err, "NeedsApproval")
+	}
+
+	switch mode {
+	case PremodAll:
+		return true, nil
+	case PremodThreads:
+		return len(obj.InReplyTo) == 0 || obj.InReplyTo[0].Id == "", nil
+	}
+
+	return false, nil
+}
+
+// HoldForReview adds obj, already written with the type Pending, to the
+// approval queue of the board with the reasons it was held for.
+func (actor Actor) HoldForReview(obj ObjectBase, reasons []string) error {
+	reason := []rune(strings.Join(reasons, ", "))
+	if len(reason) > 100 {
+		reason = reason[:100]
+	}
+
+	bump := true
+	for _, e := range obj.Option {
+		if e == "sage" || e == "nokosage" {
+			bump = false
+		}
+	}
+
+	query := `insert into pending (id, actor, reason, bump) values ($1, $2, $3, $4) on conflict do nothing`
+	_, err := config.DB.Exec(query, obj.Id, actor.Id, string(reason), bump)
+
+	return util.MakeError(err, "HoldForReview")
+}
+
+// GetPending returns the approval queue of the board, oldest first.
+func (actor Actor) GetPending() ([]PendingPost, error) {
+	var queue []PendingPost
+
+	query := `select x.id, x.name, x.alias, x.content, x.published, x.updated, x.attributedto, x.attachment, x.preview, x.actor, x.tripcode, x.sensitive, x.posterid, p.reason from (select id, name, alias, content, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive, posterid from activitystream where type='Pending' union select id, name, alias, content, published, updated, attributedto, attachment, preview, actor, tripcode, sensitive, posterid from cacheactivitystream where type='Pending') as x join pending p on p.id=x.id where p.actor=$1 order by p.published asc`
+	rows, err := config.DB.Query(query, actor.Id)
+
+	if err != nil {
+		return queue, util.MakeError(err, "GetPending")
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var pending PendingPost
+		var post ObjectBase
+
+		var attch ObjectBase
+		post.Attachment = append(post.Attachment, attch)
+
+		var prev NestedObjectBase
+		post.Preview = &prev
+
+		if err := rows.Scan(&post.Id, &post.Name, &post.Alias, &post.Content, &post.Published, &post.Updated, &post.AttributedTo, &post.Attachment[0].Id, &post.Preview.Id, &post.Actor, &post.TripCode, &post.Sensitive, &post.PosterId, &pending.Reason); err != nil {
+			return queue, util.MakeError(err, "GetPending")
+		}
+
+		post.Type = PendingType
+
+		if post.Attachment, err = post.Attachment[0].GetAttachment(); err != nil {
+			return queue, util.MakeError(err, "GetPending")
+		}
+
+		if post.Preview, err = post.Preview.GetPreview(); err != nil {
+			return queue, util.MakeError(err, "GetPending")
+		}
+
+		post.Tag, _ = post.GetTags()
+
+		if OP, _ := post.GetOP(); OP != post.Id {
+			pending.OP = OP
+		}
+
+		pending.Object = post
+		queue = append(queue, pending)
+	}
+
+	return queue, nil
+}
+
+// IsPending returns true if obj is waiting for approval.
+func (obj ObjectBase) IsPending() (bool, error) {
+	var count int
+
+	query := `select count(*) from pending where id=$1`
+	if err := config.DB.QueryRow(query, obj.Id).Scan(&count); err != nil {
+		return false, util.MakeError(err, "IsPending")
+	}
+
+	return count > 0, nil
+}
+
+// Approve shows obj on the board, bumping its thread unless it was saged,
+// and returns it as it is sent to followers.
+func (actor Actor) Approve(obj ObjectBase) (ObjectBase, error) {
+	var bump bool
+
+	query := `delete from pending where id=$1 and actor=$2 returning bump`
+	if err := config.DB.QueryRow(query, obj.Id, actor.Id).Scan(&bump); err != nil {
+		return obj, util.MakeError(errors.New("post is not pending"), "Approve")
+	}
+
+	nType := "Note"
+
+	OP, _ := obj.GetOP()
+	if OP != obj.Id {
+		thread := ObjectBase{Id: OP}
+
+		if t, _ := thread.GetType(); t == "Archive" {
+			nType = "Archive"
+		} else if bump {
+			if err := thread.WriteUpdate(time.Now().UTC()); err != nil {
+				return obj, util.MakeError(err, "Approve")
+			}
+		}
+	}
+
+	query = `update activitystream set type=$2 where id=$1 and type=$3`
+	if _, err := config.DB.Exec(query, obj.Id, nType, PendingType); err != nil {
+		return obj, util.MakeError(err, "Approve")
+	}
+
+	query = `update cacheactivitystream set type=$2 where id=$1 and type=$3`
+	if _, err := config.DB.Exec(query, obj.Id, nType, PendingType); err != nil {
+		return obj, util.MakeError(err, "Approve")
+	}
+
+	col, err := obj.GetCollectionFromPath()
+
+	if err != nil || len(col.OrderedItems) == 0 {
+		return obj, util.MakeError(err, "Approve")
+	}
+
+	obj = col.OrderedItems[0]
+
+	// remote boards of the posts replied to get the post as well
+	for _, e := range obj.InReplyTo {
+		if local, _ := e.IsLocal(); local {
+			continue
+		}
+
+		if actor, err := FingerActor(e.Id); err == nil && !util.IsInStringArray(obj.To, actor.Id) {
+			obj.To = append(obj.To, actor.Id)
+		}
+	}
+
+	return obj, nil
+}
+
+// Reject deletes obj and the posts waiting on it.
+func (actor Actor) Reject(obj ObjectBase, reason string) error {
+	var id string
+
+	query := `delete from pending where id=$1 and actor=$2 returning id`
+	if err := config.DB.QueryRow(query, obj.Id, actor.Id).Scan(&id); err != nil {
+		return util.MakeError(errors.New("post is not pending"), "Reject")
+	}
+
+	query = `delete from pending where id in (select id from replies where inreplyto=$1)`
+	if _, err := config.DB.Exec(query, obj.Id); err != nil {
+		return util.MakeError(err, "Reject")
+	}
+
+	config.Log.Printf("rejected pending post %s: %s", obj.Id, reason)
+
+	if isOP, _ := obj.CheckIfOP(); isOP {
+		return util.MakeError(obj.TombstoneReplies(), "Reject")
+	}
+
+	return util.MakeError(obj.Tombstone(), "Reject")
+}
@@ -0,0 +1,376 @@
+package activitypub
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/FChannel0/FChannel-Server/config"
+	"github.com/FChannel0/FChannel-Server/util"
+)
+
+// Polls are stored beside the Note they were posted with and sent as a
+// Question, the choices in oneOf, or anyOf if more than one may be picked.
+// Votes are Notes replying to the poll with the choice as their name, the way
+// Mastodon and Pleroma send them. Votes on remote polls are sent to the board
+// of the poll, which sends the new counts to its followers in an Update. They
+// are kept here only so each voter votes once, the counts are the ones sent.
+// Boards count one vote for each actor signing them, so all the votes sent
+// from this instance to a poll only count as the vote of the instance actor.
+
+// choices past this are dropped from remote polls
+const maxPollChoices = 10
+
+type objectBase ObjectBase
+
+// MarshalJSON sends posts with a poll as a Question.
+func (obj ObjectBase) MarshalJSON() ([]byte, error) {
+	nObj := objectBase(obj)
+
+	if nObj.Type == "Note" && (len(nObj.OneOf) > 0 || len(nObj.AnyOf) > 0) {
+		nObj.Type = "Question"
+	}
+
+	return json.Marshal(nObj)
+}
+
+// PollChoices returns the choices of the poll of obj.
+func (obj ObjectBase) PollChoices() []ObjectBase {
+	if len(obj.AnyOf) > 0 {
+		return obj.AnyOf
+	}
+
+	return obj.OneOf
+}
+
+// WritePoll stores the poll of obj, if it has one. The vote counts of remote
+// polls are kept as they were sent.
+func (obj ObjectBase) WritePoll() error {
+	choices := obj.PollChoices()
+
+	if len(choices) == 0 {
+		return nil
+	}
+
+	if err := obj.DeletePoll(); err != nil {
+		return util.MakeError(err, "WritePoll")
+	}
+
+	var endTime sql.NullTime
+	if t, err := time.Parse(time.RFC3339, obj.EndTime); err == nil {
+		endTime = sql.NullTime{Time: t, Valid: true}
+	}
+
+	query := `insert into polls (id, multiple, endtime, voters) values ($1, $2, $3, $4)`
+	if _, err := config.DB.Exec(query, obj.Id, len(obj.AnyOf) > 0, endTime, obj.VotersCount); err != nil {
+		return util.MakeError(err, "WritePoll")
+	}
+
+	var names []string
+	for _, e := range choices {
+		if len(names) >= maxPollChoices {
+			break
+		}
+
+		if e.Name == "" || len(e.Name) > 200 || util.IsInStringArray(names, e.Name) {
+			continue
+		}
+
+		query := `insert into pollchoices (id, name, position, votes) values ($1, $2, $3, $4)`
+		if _, err := config.DB.Exec(query, obj.Id, e.Name, len(names), e.Replies.TotalItems); err != nil {
+			return util.MakeError(err, "WritePoll")
+		}
+
+		names = append(names, e.Name)
+	}
+
+	return nil
+}
+
+// GetPoll returns obj with its poll and the current vote counts, obj is
+// returned as is if it has no poll.
+func (obj ObjectBase) GetPoll() (ObjectBase, error) {
+	var multiple bool
+	var endTime sql.NullTime
+	var voters int
+
+	query := `select multiple, endtime, voters + (select count(distinct voter) from pollvotes where id=$1 and id in (select id from activitystream)) from polls where id=$1`
+	if err := config.DB.QueryRow(query, obj.Id).Scan(&multiple, &endTime, &voters); err != nil {
+		if err == sql.ErrNoRows {
+			return obj, nil
+		}
+
+		return obj, util.MakeError(err, "GetPoll")
+	}
+
+	query = `select name, votes + (select count(*) from pollvotes v where v.id=c.id and v.name=c.name and v.id in (select id from activitystream)) from pollchoices c where id=$1 order by position asc`
+	rows, err := config.DB.Query(query, obj.Id)
+
+	if err != nil {
+		return obj, util.MakeError(err, "GetPoll")
+	}
+
+	var choices []ObjectBase
+
+	defer rows.Close()
+	for rows.Next() {
+		var choice ObjectBase
+
+		if err := rows.Scan(&choice.Name, &choice.Replies.TotalItems); err != nil {
+			return obj, util.MakeError(err, "GetPoll")
+		}
+
+		choice.Type = "Note"
+		choice.Replies.Type = "Collection"
+		choices = append(choices, choice)
+	}
+
+	if multiple {
+		obj.AnyOf = choices
+	} else {
+		obj.OneOf = choices
+	}
+
+	obj.VotersCount = voters
+
+	if endTime.Valid {
+		obj.EndTime = endTime.Time.UTC().Format(time.RFC3339)
+
+		if endTime.Time.Before(time.Now()) {
+			obj.Closed = obj.EndTime
+		}
+	}
+
+	return obj, nil
+}
+
+// UpdatePollCounts replaces the vote counts and end time of the cached remote
+// poll of obj with the ones sent in an Update, the votes made here are kept.
+func (obj ObjectBase) UpdatePollCounts() error {
+	var endTime sql.NullTime
+	if t, err := time.Parse(time.RFC3339, obj.EndTime); err == nil {
+		endTime = sql.NullTime{Time: t, Valid: true}
+	}
+
+	query := `update polls set endtime=$1, voters=$2 where id=$3`
+	if _, err := config.DB.Exec(query, endTime, obj.VotersCount, obj.Id); err != nil {
+		return util.MakeError(err, "UpdatePollCounts")
+	}
+
+	for _, e := range obj.PollChoices() {
+		query := `update pollchoices set votes=$1 where id=$2 and name=$3`
+		if _, err := config.DB.Exec(query, e.Replies.TotalItems, obj.Id, e.Name); err != nil {
+			return util.MakeError(err, "UpdatePollCounts")
+		}
+	}
+
+	return nil
+}
+
+// HasVoted returns true if voter has voted in the poll of obj.
+func (obj ObjectBase) HasVoted(voter string) (bool, error) {
+	var count int
+
+	query := `select count(*) from pollvotes where id=$1 and voter=$2`
+	if err := config.DB.QueryRow(query, obj.Id, voter).Scan(&count); err != nil {
+		return false, util.MakeError(err, "HasVoted")
+	}
+
+	return count > 0, nil
+}
+
+// Vote records the votes of voter in the poll of obj. A voter may vote once
+// in a single choice poll and once for each choice in a multiple choice one.
+func (obj ObjectBase) Vote(voter string, choices []string) error {
+	poll, err := obj.GetPoll()
+
+	if err != nil {
+		return util.MakeError(err, "Vote")
+	}
+
+	if len(poll.PollChoices()) == 0 {
+		return util.MakeError(errors.New("not a poll"), "Vote")
+	}
+
+	if poll.Closed != "" {
+		return util.MakeError(errors.New("poll is closed"), "Vote")
+	}
+
+	if len(choices) == 0 || (len(poll.AnyOf) == 0 && len(choices) > 1) {
+		return util.MakeError(errors.New("invalid number of choices"), "Vote")
+	}
+
+	for _, e := range choices {
+		valid := false
+		for _, f := range poll.PollChoices() {
+			if e == f.Name {
+				valid = true
+				break
+			}
+		}
+
+		if !valid {
+			return util.MakeError(errors.New("no such choice"), "Vote")
+		}
+	}
+
+	tx, err := config.DB.Begin()
+
+	if err != nil {
+		return util.MakeError(err, "Vote")
+	}
+
+	defer tx.Rollback()
+
+	// votes on the poll are counted one at a time
+	query := `select id from polls where id=$1 for update`
+	if _, err := tx.Exec(query, obj.Id); err != nil {
+		return util.MakeError(err, "Vote")
+	}
+
+	if len(poll.AnyOf) == 0 {
+		var voted bool
+
+		query = `select exists (select 1 from pollvotes where id=$1 and voter=$2)`
+		if err := tx.QueryRow(query, obj.Id, voter).Scan(&voted); err != nil {
+			return util.MakeError(err, "Vote")
+		}
+
+		if voted {
+			return util.MakeError(errors.New("already voted"), "Vote")
+		}
+	}
+
+	for _, e := range choices {
+		query = `insert into pollvotes (id, name, voter) values ($1, $2, $3) on conflict (id, name, voter) do nothing`
+		if _, err := tx.Exec(query, obj.Id, e, voter); err != nil {
+			return util.MakeError(err, "Vote")
+		}
+	}
+
+	return util.MakeError(tx.Commit(), "Vote")
+}
+
+// GetPollBoard returns the board the poll obj was posted to.
+func (obj ObjectBase) GetPollBoard() (Actor, error) {
+	var board string
+
+	query := `select actor from activitystream where id=$1 union select actor from cacheactivitystream where id=$1`
+	if err := config.DB.QueryRow(query, obj.Id).Scan(&board); err != nil {
+		return Actor{}, util.MakeError(err, "GetPollBoard")
+	}
+
+	if local, _ := obj.IsLocal(); local {
+		actor, err := GetActorFromDB(board)
+		return actor, util.MakeError(err, "GetPollBoard")
+	}
+
+	actor, err := FingerActor(board)
+	return actor, util.MakeError(err, "GetPollBoard")
+}
+
+// SendVote sends the votes in the remote poll obj to the board of the poll from
+// actor, one Note for each choice. The board only counts the first vote of
+// actor in a single choice poll.
+func (obj ObjectBase) SendVote(actor Actor, choices []string) error {
+	var board string
+
+	query := `select actor from cacheactivitystream where id=$1`
+	if err := config.DB.QueryRow(query, obj.Id).Scan(&board); err != nil {
+		return util.MakeError(err, "SendVote")
+	}
+
+	for _, e := range choices {
+		vote := CreateObject("Note")
+		vote.Name = e
+		vote.Actor = actor.Id
+		vote.AttributedTo = actor.Id
+		vote.InReplyTo = []ObjectBase{{Id: obj.Id}}
+		vote.To = []string{board}
+
+		var activity Activity
+		activity.AtContext.Context = "https://www.w3.org/ns/activitystreams"
+		activity.Type = "Create"
+		activity.Published = vote.Published
+		activity.Actor = &actor
+		activity.Object = vote
+		activity.To = []string{board}
+
+		if err := activity.MakeRequestInbox(); err != nil {
+			return util.MakeError(err, "SendVote")
+		}
+	}
+
+	return nil
+}
+
+// SendPollUpdate sends the current vote counts of the local poll obj to the
+// followers of its board.
+func (obj ObjectBase) SendPollUpdate() error {
+	post, err := obj.GetFromPath()
+
+	if err != nil {
+		return util.MakeError(err, "SendPollUpdate")
+	}
+
+	var nObj ObjectBase
+	nObj.Id = post.Id
+	nObj.Type = post.Type
+	nObj.Name = post.Name
+	nObj.Content = post.Content
+	nObj.Actor = post.Actor
+	nObj.AttributedTo = post.AttributedTo
+	nObj.Published = post.Published
+	nObj.Updated = time.Now().UTC()
+	nObj.OneOf = post.OneOf
+	nObj.AnyOf = post.AnyOf
+	nObj.VotersCount = post.VotersCount
+	nObj.EndTime = post.EndTime
+	nObj.Closed = post.Closed
+
+	activity, err := nObj.CreateActivity("Update")
+
+	if err != nil {
+		return util.MakeError(err, "SendPollUpdate")
+	}
+
+	if activity, err = activity.AddFollowersTo(); err != nil {
+		return util.MakeError(err, "SendPollUpdate")
+	}
+
+	return util.MakeError(activity.MakeRequestInbox(), "SendPollUpdate")
+}
+
+// IsVote returns true if obj is a vote on a poll of this instance.
+func (obj ObjectBase) IsVote() (bool, error) {
+	if obj.Name == "" || obj.Content != "" || len(obj.InReplyTo) != 1 || len(obj.Attachment) > 0 {
+		return false, nil
+	}
+
+	var count int
+
+	query := `select count(*) from polls where id=$1 and id in (select id from activitystream)`
+	if err := config.DB.QueryRow(query, obj.InReplyTo[0].Id).Scan(&count); err != nil {
+		return false, util.MakeError(err, "IsVote")
+	}
+
+	return count > 0, nil
+}
+
+func (obj ObjectBase) DeletePoll() error {
+	query := `delete from pollchoices where id=$1`
+	if _, err := config.DB.Exec(query, obj.Id); err != nil {
+		return util.MakeError(err, "DeletePoll")
+	}
+
+	query = `delete from pollvotes where id=$1`
+	if _, err := config.DB.Exec(query, obj.Id); err != nil {
+		return util.MakeError(err, "DeletePoll")
+	}
+
+	query = `delete from polls where id=$1`
+	_, err := config.DB.Exec(query, obj.Id)
+
+	return util.MakeError(err, "DeletePoll")
+}
@@ -0,0 +1,174 @@
+package activitypub
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FChannel0/FChannel-Server/config"
+)
+
+// Posts quoted in a comment are looked up in the database first, only remote
+// posts we have not stored are fetched. Fetches are made by a few background
+// workers and their results are cached, so a slow or
+// unreachable instance can not hold up posting for more than the wait given
+// to ResolveReferences.
+
+type reference struct {
+	valid   bool
+	expires time.Time
+	done    chan struct{}
+}
+
+var references = make(map[string]*reference)
+var referencesMutex sync.Mutex
+
+// fetches are made by a fixed number of workers from a bounded queue
+var referenceQueue = make(chan referenceFetch, 100)
+var referenceWorkers sync.Once
+
+type referenceFetch struct {
+	id  string
+	ref *reference
+}
+
+const (
+	referenceTimeout      = 30 * time.Second
+	referenceValidTTL     = time.Hour
+	referenceInvalidTTL   = 5 * time.Minute
+	referenceCacheEntries = 1000
+	referenceFetchers     = 4
+)
+
+// ResolveReferences reports which of ids are posts. Remote posts that are not
+// stored are fetched, ids still being fetched after wait are reported as not
+// being posts and the result is cached for the next lookup.
+func ResolveReferences(ids []string, wait time.Duration) map[string]bool {
+	valid := make(map[string]bool)
+
+	var pending []string
+	var refs []*reference
+
+	for _, id := range ids {
+		if IsPost(id) {
+			valid[id] = true
+			continue
+		}
+
+		// local posts are always stored
+		if strings.HasPrefix(id, config.Domain+"/") {
+			continue
+		}
+
+		pending = append(pending, id)
+		refs = append(refs, fetchReference(id))
+	}
+
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+
+	for i, ref := range refs {
+		select {
+		case <-ref.done:
+			valid[pending[i]] = ref.valid
+		case <-timeout.C:
+			return valid
+		}
+	}
+
+	return valid
+}
+
+// IsPost reports if id is a post stored locally or in the cache that has not
+// been deleted.
+func IsPost(id string) bool {
+	var result bool
+
+	query := `select exists (select 1 from activitystream where id=$1 and type != 'Tombstone') or exists (select 1 from cacheactivitystream where id=$1 and type != 'Tombstone')`
+	config.DB.QueryRow(query, id).Scan(&result)
+
+	return result
+}
+
+// fetchReference returns the cached lookup of id, starting a fetch if there is
+// none or it has expired.
+func fetchReference(id string) *reference {
+	referencesMutex.Lock()
+	defer referencesMutex.Unlock()
+
+	now := time.Now()
+
+	if ref, ok := references[id]; ok {
+		select {
+		case <-ref.done:
+			if now.Before(ref.expires) {
+				return ref
+			}
+		default:
+			// still being fetched
+			return ref
+		}
+	}
+
+	if len(references) >= referenceCacheEntries {
+		for k, e := range references {
+			select {
+			case <-e.done:
+				if now.After(e.expires) {
+					delete(references, k)
+				}
+			default:
+			}
+		}
+	}
+
+	ref := &reference{done: make(chan struct{})}
+
+	// entries are only added while under the limit, fetches are still made
+	// but their results are not kept
+	if len(references) < referenceCacheEntries {
+		references[id] = ref
+	}
+
+	referenceWorkers.Do(func() {
+		for i := 0; i < referenceFetchers; i++ {
+			go referenceWorker()
+		}
+	})
+
+	select {
+	case referenceQueue <- referenceFetch{id: id, ref: ref}:
+	default:
+		// too many fetches waiting, report id as not a post for now
+		ref.expires = now.Add(referenceInvalidTTL)
+		close(ref.done)
+	}
+
+	return ref
+}
+
+// referenceWorker makes the fetches queued by fetchReference.
+func referenceWorker() {
+	for e := range referenceQueue {
+		ctx, cancel := context.WithTimeout(context.Background(), referenceTimeout)
+		_, valid, err := Activity{Id: e.id}.CheckValidContext(ctx)
+		cancel()
+
+		if err != nil {
+			config.Log.Println(err)
+		}
+
+		ttl := referenceInvalidTTL
+		if valid {
+			ttl = referenceValidTTL
+		}
+
+		referencesMutex.Lock()
+		e.ref.valid = valid
+		e.ref.expires = time.Now().Add(ttl)
+		referencesMutex.Unlock()
+
+		close(e.ref.done)
+	}
+}
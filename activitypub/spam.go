@@ -0,0 +1,57 @@
+package activitypub
+
+import (
+	"github.com/FChannel0/FChannel-Server/config"
+	"github.com/FChannel0/FChannel-Server/util"
+)
+
+// What the spam check decided for a post.
+const (
+	SpamAllow  = "allow"
+	SpamHold   = "hold"
+	SpamReject = "reject"
+)
+
+// SpamCheck scores federated posts sent to actor before they are cached and
+// returns whether to allow, hold or reject them with the reasons. It is set to
+// the spam filters of the post package when the server starts.
+var SpamCheck func(actor Actor, obj ObjectBase) (string, []string, error)
+
+// GetSpamThresholds returns the scores at which posts on the board are held
+// for review and rejected, a threshold of 0 is off.
+func (actor Actor) GetSpamThresholds() (int, int, error) {
+	var hold, reject int
+
+	query := `select spamhold, spamreject from actor where id=$1`
+	if err := config.DB.QueryRow(query, actor.Id).Scan(&hold, &reject); err != nil {
+		return 0, 0, util.MakeError(err, "GetSpamThresholds")
+	}
+
+	return hold, reject, nil
+}
+
+func (actor Actor) SetSpamThresholds(hold int, reject int) error {
+	query := `update actor set spamhold=$1, spamreject=$2 where id=$3`
+	_, err := config.DB.Exec(query, hold, reject, actor.Id)
+
+	return util.MakeError(err, "SetSpamThresholds")
+}
+
+// SpamVerdict returns what to do with a post with the given spam score.
+func (actor Actor) SpamVerdict(score int) (string, error) {
+	hold, reject, err := actor.GetSpamThresholds()
+
+	if err != nil {
+		return SpamAllow, util.MakeError(err, "SpamVerdict")
+	}
+
+	if reject > 0 && score >= reject {
+		return SpamReject, nil
+	}
+
+	if hold > 0 && score >= hold {
+		return SpamHold, nil
+	}
+
+	return SpamAllow, nil
+}
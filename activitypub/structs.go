@@ -114,11 +114,16 @@ type ObjectBase struct {
 	Alias        string            `json:"alias,omitempty"`
 	AttributedTo string            `json:"attributedTo,omitempty"`
 	TripCode     string            `json:"tripcode,omitempty"`
+	PosterId     string            `json:"posterId,omitempty"`
 	Actor        string            `json:"actor,omitempty"`
 	Audience     string            `json:"audience,omitempty"`
 	ContentHTML  template.HTML     `json:"contenthtml,omitempty"`
 	Content      string            `json:"content,omitempty"`
 	EndTime      string            `json:"endTime,omitempty"`
+	OneOf        []ObjectBase      `json:"oneOf,omitempty"`
+	AnyOf        []ObjectBase      `json:"anyOf,omitempty"`
+	Closed       string            `json:"closed,omitempty"`
+	VotersCount  int               `json:"votersCount,omitempty"`
 	Generator    string            `json:"generator,omitempty"`
 	Icon         string            `json:"icon,omitempty"`
 	Image        string            `json:"image,omitempty"`
@@ -133,6 +138,7 @@ type ObjectBase struct {
 	StartTime    string            `json:"startTime,omitempty"`
 	Summary      string            `json:"summary,omitempty"`
 	Tag          []ObjectBase      `json:"tag,omitempty"`
+	Backlinks    []ObjectBase      `json:"backlinks,omitempty"`
 	Wallet       []CryptoCur       `json:"wallet,omitempty"`
 	Deleted      string            `json:"deleted,omitempty"`
 	Url          []ObjectBase      `json:"url,omitempty"`
@@ -143,10 +149,15 @@ type ObjectBase struct {
 	Bcc          string            `json:"Bcc,omitempty"`
 	MediaType    string            `json:"mediatype,omitempty"`
 	Duration     string            `json:"duration,omitempty"`
+	Width        int               `json:"width,omitempty"`
+	Height       int               `json:"height,omitempty"`
+	Blurhash     string            `json:"blurhash,omitempty"`
 	Size         int64             `json:"size,omitempty"`
 	Sensitive    bool              `json:"sensitive,omitempty"`
 	Sticky       bool              `json:"sticky,omitempty"`
 	Locked       bool              `json:"locked,omitempty"`
+	// Link is the href a board link tag is rendered with, it is not sent
+	Link string `json:"-"`
 }
 
 type CryptoCur struct {
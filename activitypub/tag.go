@@ -0,0 +1,110 @@
+package activitypub
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/FChannel0/FChannel-Server/config"
+	"github.com/FChannel0/FChannel-Server/util"
+)
+
+// Tags of posts, such as links to boards and posts on other boards, are stored
+// in their own table and sent with the Note.
+
+// ObjectLinkType is the media type of a tag linking to another object, see
+// FEP-e232.
+const ObjectLinkType = `application/ld+json; profile="https://www.w3.org/ns/activitystreams"`
+
+// FlagType is the type of the tag holding the country code of the poster,
+// "xp" for Tor and "xx" if it is unknown.
+const FlagType = "Flag"
+
+// DiceType and FortuneType are the types of the tags holding the dice and
+// fortune rolled for the post. The name is what was asked for and the content
+// the result.
+const DiceType = "Dice"
+const FortuneType = "Fortune"
+
+var flagRe = regexp.MustCompile(`^[a-z]{2}$`)
+
+// tags past this are dropped from remote posts
+const maxTags = 50
+
+// BoardLinkHref returns the href a board link tag is rendered with. It is set
+// to the board links of the post package when the server starts and fills in
+// the link of tags that were not resolved here.
+var BoardLinkHref func(tag ObjectBase) string
+
+// WriteTags replaces the stored tags of the post with obj.Tag.
+func (obj ObjectBase) WriteTags() error {
+	if err := obj.DeleteTags(); err != nil {
+		return util.MakeError(err, "WriteTags")
+	}
+
+	for i, e := range obj.Tag {
+		if i >= maxTags {
+			break
+		}
+
+		if e.Type == "" || len(e.Type) > 50 || len(e.Name) > 200 || len(e.Href) > 2000 || len(e.MediaType) > 200 || len(e.Content) > 1000 {
+			continue
+		}
+
+		if e.Link == "" && strings.HasPrefix(e.Name, ">>>") && BoardLinkHref != nil {
+			e.Link = BoardLinkHref(e)
+		}
+
+		if len(e.Link) > 2000 {
+			e.Link = ""
+		}
+
+		query := `insert into tags (id, type, name, href, mediatype, content, link) values ($1, $2, $3, $4, $5, $6, $7)`
+		if _, err := config.DB.Exec(query, obj.Id, e.Type, e.Name, e.Href, e.MediaType, e.Content, e.Link); err != nil {
+			return util.MakeError(err, "WriteTags")
+		}
+	}
+
+	return nil
+}
+
+func (obj ObjectBase) GetTags() ([]ObjectBase, error) {
+	var tags []ObjectBase
+
+	query := `select type, name, href, mediatype, content, link from tags where id=$1`
+	rows, err := config.DB.Query(query, obj.Id)
+
+	if err != nil {
+		return tags, util.MakeError(err, "GetTags")
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var tag ObjectBase
+
+		if err := rows.Scan(&tag.Type, &tag.Name, &tag.Href, &tag.MediaType, &tag.Content, &tag.Link); err != nil {
+			return tags, util.MakeError(err, "GetTags")
+		}
+
+		tags = append(tags, tag)
+	}
+
+	return tags, nil
+}
+
+func (obj ObjectBase) DeleteTags() error {
+	query := `delete from tags where id=$1`
+	_, err := config.DB.Exec(query, obj.Id)
+
+	return util.MakeError(err, "DeleteTags")
+}
+
+// GetFlag returns the country code of the flag tag of the post.
+func (obj ObjectBase) GetFlag() string {
+	for _, e := range obj.Tag {
+		if e.Type == FlagType && flagRe.MatchString(e.Name) {
+			return e.Name
+		}
+	}
+
+	return ""
+}
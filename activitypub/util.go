@@ -32,35 +32,57 @@ func AcceptActivity(header string) bool {
 	return accept
 }
 
+// CreateAttachmentObject returns the attachment for file and a temporary file
+// to write it to before it is put in storage. Files are named by the hash of
+// their content, if the same file has already been stored the attachment uses
+// it and no file is returned.
 func CreateAttachmentObject(file multipart.File, header *multipart.FileHeader) ([]ObjectBase, *os.File, error) {
 	contentType, err := util.GetFileContentType(file)
 	if err != nil {
 		return nil, nil, util.MakeError(err, "CreateAttachmentObject")
 	}
 
+	fileBytes, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, nil, util.MakeError(err, "CreateAttachmentObject")
+	}
+
+	file.Seek(0, 0)
+
 	filename := header.Filename
 	size := header.Size
 
 	fileType := path.Ext(header.Filename)
-	name := fmt.Sprint(time.Now().UTC().Unix())
-
-	tempFile, err := os.Create(fmt.Sprintf("./public/%s%s", name, fileType))
-	if err != nil {
-		return nil, nil, util.MakeError(err, "CreateAttachmentObject")
-	}
+	hash := util.HashBytes(fileBytes)
 
 	var nAttachment []ObjectBase
 	var image ObjectBase
 
 	image.Type = "Attachment"
 	image.Name = filename
-	image.Href = fmt.Sprintf("%s/public/%s%s", config.Domain, name, fileType)
+	image.Href = fmt.Sprintf("%s/public/%s%s", config.Domain, hash, fileType)
 	image.MediaType = contentType
 	image.Size = size
 	image.Published = time.Now().UTC()
 
+	href, store, err := ReserveMedia(hash, image.Href)
+	if err != nil {
+		return nil, nil, util.MakeError(err, "CreateAttachmentObject")
+	}
+
+	image.Href = href
 	nAttachment = append(nAttachment, image)
 
+	if !store {
+		return nAttachment, nil, nil
+	}
+
+	// the attachment is returned so the caller releases the reference
+	tempFile, err := os.CreateTemp("", "fchan-*"+fileType)
+	if err != nil {
+		return nAttachment, nil, util.MakeError(err, "CreateAttachmentObject")
+	}
+
 	return nAttachment, tempFile, nil
 }
 
@@ -194,6 +216,18 @@ func GetObjectFromJson(obj []byte) (ObjectBase, error) {
 		case map[string]interface{}:
 			var arrContext Object
 
+			// other software sends inReplyTo as a single id
+			if m := generic.(map[string]interface{}); m["inReplyTo"] != nil {
+				if id, ok := m["inReplyTo"].(string); ok {
+					m["inReplyTo"] = []map[string]string{{"id": id}}
+
+					var err error
+					if obj, err = json.Marshal(m); err != nil {
+						return nObj, util.MakeError(err, "GetObjectFromJson")
+					}
+				}
+			}
+
 			if err := json.Unmarshal(obj, &arrContext.Object); err != nil {
 				return nObj, util.MakeError(err, "GetObjectFromJson")
 			}
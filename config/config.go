@@ -43,6 +43,18 @@ var MaxAttachmentSize, _ = strconv.Atoi(GetConfigValue("maxattachsize", "7340032
 var MaxMindDB = GetConfigValue("maxminddb", "")
 var TorExitList = GetConfigValue("torexitlist", "")
 var ProxyHeader = GetConfigValue("proxyheader", "")
+var PhashDistance, _ = strconv.Atoi(GetConfigValue("phashdistance", "4"))
+var PhashFrames = getPhashFrames()
+var FallbackFormat = GetConfigValue("fallbackformat", "png")
+var Storage = GetConfigValue("storage", "local")
+var S3Endpoint = GetConfigValue("s3endpoint", "")
+var S3Region = GetConfigValue("s3region", "us-east-1")
+var S3Bucket = GetConfigValue("s3bucket", "")
+var S3AccessKey = GetConfigValue("s3accesskey", "")
+var S3SecretKey = GetConfigValue("s3secretkey", "")
+var S3PublicURL = GetConfigValue("s3publicurl", "")
+var S3SignedURLs = GetConfigValue("s3signedurls", "false")
+var S3URLExpiry = GetConfigValue("s3urlexpiry", "3600")
 var Themes []string
 var DB *sql.DB
 
@@ -69,3 +81,16 @@ func GetConfigValue(value string, ifnone string) string {
 
 	return ifnone
 }
+
+// getPhashFrames returns the number of frames of gifs and videos hashed for
+// media bans, with no frames they could not be banned or matched.
+func getPhashFrames() int {
+	frames, err := strconv.Atoi(GetConfigValue("phashframes", "5"))
+
+	if err != nil || frames < 1 || frames > 50 {
+		Log.Println("phashframes must be between 1 and 50, using 5")
+		return 5
+	}
+
+	return frames
+}
@@ -0,0 +1,204 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"github.com/FChannel0/FChannel-Server/activitypub"
+	"github.com/FChannel0/FChannel-Server/config"
+	"github.com/FChannel0/FChannel-Server/util"
+)
+
+// Banned users can appeal each of their bans once from the banned page. Staff
+// of the board of the ban, or the instance admin for bans on every board,
+// accept, deny or shorten the ban and the user sees the outcome on their next
+// visit.
+
+const (
+	AppealPending   = "pending"
+	AppealAccepted  = "accepted"
+	AppealDenied    = "denied"
+	AppealShortened = "shortened"
+)
+
+type Appeal struct {
+	Id       int
+	Ban      Ban
+	Message  string
+	Status   string
+	Response string
+	Created  time.Time
+	// post the ban was given for, empty if it is gone
+	Object activitypub.ObjectBase
+}
+
+// GetBanForIP returns the active ban with id if ip is under it.
+func GetBanForIP(id int, ip string) (Ban, error) {
+	var ban Ban
+
+	query := `select id, ip, reason, date, expires, board, post from bannedips where id=$1 and $2 <<= ip and expires > now()`
+	if err := config.DB.QueryRow(query, id, ip).Scan(&ban.Id, &ban.IP, &ban.Reason, &ban.Date, &ban.Expires, &ban.Board, &ban.Post); err != nil {
+		return ban, util.MakeError(errors.New("ban not found"), "GetBanForIP")
+	}
+
+	return ban, nil
+}
+
+// CreateAppeal appeals ban, a ban can only be appealed once.
+func CreateAppeal(ban Ban, message string) error {
+	if r := []rune(message); len(r) > 2000 {
+		message = string(r[:2000])
+	}
+
+	query := `insert into appeals (ban, message) values ($1, $2) on conflict (ban) do nothing`
+	_, err := config.DB.Exec(query, ban.Id, message)
+
+	return util.MakeError(err, "CreateAppeal")
+}
+
+// GetBanAppeals returns the appeals made of the bans of ip by ban id.
+func GetBanAppeals(ip string) (map[int]Appeal, error) {
+	var appeals = make(map[int]Appeal)
+
+	query := `select a.id, a.ban, a.message, a.status, a.response, a.created from appeals a join bannedips b on b.id=a.ban where $1 <<= b.ip`
+	rows, err := config.DB.Query(query, ip)
+
+	if err != nil {
+		return appeals, util.MakeError(err, "GetBanAppeals")
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var appeal Appeal
+
+		if err := rows.Scan(&appeal.Id, &appeal.Ban.Id, &appeal.Message, &appeal.Status, &appeal.Response, &appeal.Created); err != nil {
+			return appeals, util.MakeError(err, "GetBanAppeals")
+		}
+
+		appeals[appeal.Ban.Id] = appeal
+	}
+
+	return appeals, nil
+}
+
+// GetAppealOutcomes returns the appeals of the bans of ip decided since its
+// last visit and marks them as seen.
+func GetAppealOutcomes(ip string) ([]Appeal, error) {
+	var appeals []Appeal
+
+	query := `update appeals a set seen=true from bannedips b where b.id=a.ban and $1 <<= b.ip and a.status!=$2 and a.seen=false returning a.id, a.status, a.response, b.reason, b.expires, b.board`
+	rows, err := config.DB.Query(query, ip, AppealPending)
+
+	if err != nil {
+		return appeals, util.MakeError(err, "GetAppealOutcomes")
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var appeal Appeal
+
+		if err := rows.Scan(&appeal.Id, &appeal.Status, &appeal.Response, &appeal.Ban.Reason, &appeal.Ban.Expires, &appeal.Ban.Board); err != nil {
+			return appeals, util.MakeError(err, "GetAppealOutcomes")
+		}
+
+		appeals = append(appeals, appeal)
+	}
+
+	return appeals, nil
+}
+
+// GetPendingAppeals returns the appeals waiting on staff of board, of bans on
+// every board if board is empty, oldest first.
+func GetPendingAppeals(board string) ([]Appeal, error) {
+	var appeals []Appeal
+
+	query := `select a.id, a.message, a.created, b.id, b.ip, b.reason, b.date, b.expires, b.board, b.post from appeals a join bannedips b on b.id=a.ban where b.board=$1 and a.status=$2 order by a.created asc`
+	rows, err := config.DB.Query(query, board, AppealPending)
+
+	if err != nil {
+		return appeals, util.MakeError(err, "GetPendingAppeals")
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var appeal Appeal
+
+		if err := rows.Scan(&appeal.Id, &appeal.Message, &appeal.Created, &appeal.Ban.Id, &appeal.Ban.IP, &appeal.Ban.Reason, &appeal.Ban.Date, &appeal.Ban.Expires, &appeal.Ban.Board, &appeal.Ban.Post); err != nil {
+			return appeals, util.MakeError(err, "GetPendingAppeals")
+		}
+
+		appeal.Status = AppealPending
+
+		if appeal.Ban.Post != "" {
+			obj := activitypub.ObjectBase{Id: appeal.Ban.Post}
+
+			if col, _ := obj.GetCollectionFromPath(); len(col.OrderedItems) > 0 {
+				appeal.Object = col.OrderedItems[0]
+			}
+		}
+
+		appeals = append(appeals, appeal)
+	}
+
+	return appeals, nil
+}
+
+func GetAppeal(id int) (Appeal, error) {
+	var appeal Appeal
+
+	query := `select a.id, a.message, a.status, a.response, a.created, b.id, b.ip, b.reason, b.date, b.expires, b.board, b.post from appeals a join bannedips b on b.id=a.ban where a.id=$1`
+	if err := config.DB.QueryRow(query, id).Scan(&appeal.Id, &appeal.Message, &appeal.Status, &appeal.Response, &appeal.Created, &appeal.Ban.Id, &appeal.Ban.IP, &appeal.Ban.Reason, &appeal.Ban.Date, &appeal.Ban.Expires, &appeal.Ban.Board, &appeal.Ban.Post); err != nil {
+		return appeal, util.MakeError(err, "GetAppeal")
+	}
+
+	return appeal, nil
+}
+
+// Decide closes the appeal with status and the response for the user. An
+// accepted appeal lifts the ban and a shortened one makes it expire at
+// expires. Appeals can only be decided once.
+func (appeal Appeal) Decide(status string, response string, expires time.Time) error {
+	if r := []rune(response); len(r) > 512 {
+		response = string(r[:512])
+	}
+
+	switch status {
+	case AppealAccepted, AppealDenied:
+	case AppealShortened:
+		if !expires.Before(appeal.Ban.Expires) {
+			return util.MakeError(errors.New("ban is not shortened"), "Decide")
+		}
+	default:
+		return util.MakeError(errors.New("invalid appeal status"), "Decide")
+	}
+
+	tx, err := config.DB.Begin()
+
+	if err != nil {
+		return util.MakeError(err, "Decide")
+	}
+
+	defer tx.Rollback()
+
+	var id int
+
+	query := `update appeals set status=$1, response=$2, decided=timezone('utc', now()) where id=$3 and status=$4 returning id`
+	if err := tx.QueryRow(query, status, response, appeal.Id, AppealPending).Scan(&id); err != nil {
+		return util.MakeError(errors.New("appeal was already decided"), "Decide")
+	}
+
+	switch status {
+	case AppealAccepted:
+		query = `update bannedips set expires=timezone('utc', now()) where id=$1`
+		if _, err := tx.Exec(query, appeal.Ban.Id); err != nil {
+			return util.MakeError(err, "Decide")
+		}
+	case AppealShortened:
+		query = `update bannedips set expires=$1 where id=$2`
+		if _, err := tx.Exec(query, expires.UTC(), appeal.Ban.Id); err != nil {
+			return util.MakeError(err, "Decide")
+		}
+	}
+
+	return util.MakeError(tx.Commit(), "Decide")
+}
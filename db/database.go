@@ -2,16 +2,17 @@ package db
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"html/template"
 	"io/ioutil"
-	"os"
 	"regexp"
 	"strings"
 	"time"
 
 	"github.com/FChannel0/FChannel-Server/activitypub"
 	"github.com/FChannel0/FChannel-Server/config"
+	"github.com/FChannel0/FChannel-Server/storage"
 	"github.com/FChannel0/FChannel-Server/util"
 	_ "github.com/jackc/pgx/v5/stdlib"
 )
@@ -23,10 +24,15 @@ type NewsItem struct {
 }
 
 type Ban struct {
+	Id      int
 	IP      string
 	Reason  string
 	Date    time.Time
 	Expires time.Time
+	// name of the board the ban is for, empty for the whole instance
+	Board string
+	// id of the post the ban was given for
+	Post string
 }
 
 func Connect() error {
@@ -150,14 +156,14 @@ func RemovePreviewFromFile(id string) error {
 		return nil
 	}
 
-	href = strings.Replace(href, config.Domain+"/", "", 1)
-
-	if href != "static/notfound.png" {
-		if _, err := os.Stat(href); err != nil {
+	if href != config.Domain+"/static/notfound.png" && !activitypub.IsMediaPreview(href) {
+		if exists, err := storage.Exists(href); err != nil {
 			return util.MakeError(err, "RemovePreviewFromFile")
+		} else if !exists {
+			return util.MakeError(errors.New("preview not found"), "RemovePreviewFromFile")
 		}
 
-		err := os.Remove(href)
+		err := storage.Delete(href)
 		return util.MakeError(err, "RemovePreviewFromFile")
 	}
 
@@ -398,24 +404,90 @@ func IsHashBanned(hash string) (bool, error) {
 	return h == hash, nil
 }
 
-func IsIPBanned(i string) (string, string, time.Time, time.Time, error) {
+// IsIPBanned returns the longest running ban of i on board, bans for the whole
+// instance included. Only instance bans are checked if board is empty.
+func IsIPBanned(i string, board string) (string, string, time.Time, time.Time, error) {
 	var ip string
 	var reason string
 	var date time.Time
 	var expires time.Time
 
 	// Worth also including NULL values just incase?
-	query := `select ip, reason, date, expires from bannedips where $1 <<= ip AND expires > now() ORDER BY "expires" DESC;`
-	_ = config.DB.QueryRow(query, i).Scan(&ip, &reason, &date, &expires)
+	query := `select ip, reason, date, expires from bannedips where $1 <<= ip AND (board='' OR board=$2) AND expires > now() ORDER BY "expires" DESC;`
+	_ = config.DB.QueryRow(query, i, board).Scan(&ip, &reason, &date, &expires)
 
 	return ip, reason, date, expires, nil
 }
 
+// GetActiveBans returns the bans on every board that ip is under, longest
+// running first.
+func GetActiveBans(ip string) ([]Ban, error) {
+	var bans []Ban
+
+	query := `select id, ip, reason, date, expires, board, post from bannedips where $1 <<= ip AND expires > now() ORDER BY expires DESC`
+	rows, err := config.DB.Query(query, ip)
+
+	if err != nil {
+		return bans, util.MakeError(err, "GetActiveBans")
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var ban Ban
+
+		if err := rows.Scan(&ban.Id, &ban.IP, &ban.Reason, &ban.Date, &ban.Expires, &ban.Board, &ban.Post); err != nil {
+			return bans, util.MakeError(err, "GetActiveBans")
+		}
+
+		bans = append(bans, ban)
+	}
+
+	return bans, nil
+}
+
+// R9KMuteReason starts the reason of the bans given for posting unoriginal
+// content on R9K boards.
+const R9KMuteReason = "R9K mute"
+
+// R9KMute bans ip for posting unoriginal content. The mute starts at two
+// minutes and doubles with each mute ip got before, up to 30 days.
+func R9KMute(ip string, board string) (time.Time, error) {
+	var count int
+
+	query := `select count(*) from bannedips where ip=$1::inet and reason like $2`
+	if err := config.DB.QueryRow(query, ip, R9KMuteReason+"%").Scan(&count); err != nil {
+		return time.Time{}, util.MakeError(err, "R9KMute")
+	}
+
+	duration := 2 * time.Minute
+	for i := 0; i < count && duration < 30*24*time.Hour; i++ {
+		duration *= 2
+	}
+
+	if duration > 30*24*time.Hour {
+		duration = 30 * 24 * time.Hour
+	}
+
+	expires := time.Now().UTC().Add(duration)
+	err := BanIP(Ban{IP: ip, Board: board, Reason: R9KMuteReason + ": post was not original", Expires: expires})
+
+	return expires, util.MakeError(err, "R9KMute")
+}
+
+// BanIP bans the IP or range of ban on its board, or the whole instance if
+// it has none, until it expires.
+func BanIP(ban Ban) error {
+	query := `insert into bannedips (ip, reason, date, expires, board, post) values ($1, $2, $3, $4, $5, $6)`
+	_, err := config.DB.Exec(query, ban.IP, ban.Reason, time.Now().UTC(), ban.Expires.UTC(), ban.Board, ban.Post)
+
+	return util.MakeError(err, "BanIP")
+}
+
 func GetAllBansForIP(ip string) ([]Ban, error) {
 	var bans []Ban
 
 	// Display permanent bans at top, else sort by date
-	query := `SELECT ip, reason, date, expires FROM bannedips where $1 <<= ip ORDER BY (CASE WHEN expires ='9999-12-31 00:00:00' then '1' else '2' END) ASC, date DESC;`
+	query := `SELECT id, ip, reason, date, expires, board, post FROM bannedips where $1 <<= ip ORDER BY (CASE WHEN expires ='9999-12-31 00:00:00' then '1' else '2' END) ASC, date DESC;`
 	rows, err := config.DB.Query(query, ip)
 	if err != nil {
 		return nil, err
@@ -424,7 +496,7 @@ func GetAllBansForIP(ip string) ([]Ban, error) {
 
 	for rows.Next() {
 		var ban Ban
-		err := rows.Scan(&ban.IP, &ban.Reason, &ban.Date, &ban.Expires)
+		err := rows.Scan(&ban.Id, &ban.IP, &ban.Reason, &ban.Date, &ban.Expires, &ban.Board, &ban.Post)
 		if err != nil {
 			return nil, err
 		}
@@ -498,6 +570,43 @@ func GetPostIP(post string) string {
 	return ip
 }
 
+// GetPostsByIP returns the posts made from ip since, oldest first. Replies
+// have the thread they are in as InReplyTo.
+func GetPostsByIP(ip string, since time.Time) ([]activitypub.ObjectBase, error) {
+	var posts []activitypub.ObjectBase
+
+	query := `select p.id, p.name, p.content, p.published, p.actor, coalesce(a.id, ''), coalesce(a.name, ''), coalesce(a.href, ''), coalesce(a.mediatype, ''), coalesce(a.size, 0), coalesce(a.fallback, ''), coalesce(v.id, ''), coalesce(v.href, ''), coalesce(v.mediatype, ''), coalesce((select r.id from replies r where r.inreplyto='' and r.id in (select inreplyto from replies where id=p.id) limit 1), '') from identify i join activitystream p on p.id=i.id left join activitystream a on a.id=p.attachment left join activitystream v on v.id=p.preview where i.ip=$1::inet and i.posted > $2 and (p.type='Note' or p.type='Archive') order by i.posted asc`
+	rows, err := config.DB.Query(query, ip, since.UTC())
+
+	if err != nil {
+		return posts, util.MakeError(err, "GetPostsByIP")
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var post activitypub.ObjectBase
+		var attachment activitypub.ObjectBase
+		var preview activitypub.NestedObjectBase
+		var fallback, op string
+
+		if err := rows.Scan(&post.Id, &post.Name, &post.Content, &post.Published, &post.Actor, &attachment.Id, &attachment.Name, &attachment.Href, &attachment.MediaType, &attachment.Size, &fallback, &preview.Id, &preview.Href, &preview.MediaType, &op); err != nil {
+			return posts, util.MakeError(err, "GetPostsByIP")
+		}
+
+		attachment.Url = activitypub.FallbackUrl(fallback)
+		post.Attachment = []activitypub.ObjectBase{attachment}
+		post.Preview = &preview
+
+		if op != "" {
+			post.InReplyTo = []activitypub.ObjectBase{{Id: op}}
+		}
+
+		posts = append(posts, post)
+	}
+
+	return posts, nil
+}
+
 func IsTombstone(id string) bool {
 	var result bool
 
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"github.com/FChannel0/FChannel-Server/config"
+	"github.com/FChannel0/FChannel-Server/util"
+)
+
+// Board filters are regular expressions the owner of a board matches against
+// new posts, each with the action taken when it matches.
+
+const (
+	FilterReject  = "reject"
+	FilterDrop    = "drop"
+	FilterReplace = "replace"
+	FilterReport  = "report"
+	FilterBan     = "ban"
+)
+
+var FilterActions = []string{FilterReject, FilterDrop, FilterReplace, FilterReport, FilterBan}
+
+type BoardFilter struct {
+	Id          int
+	Actor       string
+	Regex       string
+	Action      string
+	Replacement string
+	Message     string
+	Duration    int
+	Hits        int
+}
+
+func GetBoardFilters(actor string) ([]BoardFilter, error) {
+	var filters []BoardFilter
+
+	query := `select id, actor, regex, action, replacement, message, duration, hits from boardfilters where actor=$1 order by id asc`
+	rows, err := config.DB.Query(query, actor)
+
+	if err != nil {
+		return filters, util.MakeError(err, "GetBoardFilters")
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var filter BoardFilter
+
+		if err := rows.Scan(&filter.Id, &filter.Actor, &filter.Regex, &filter.Action, &filter.Replacement, &filter.Message, &filter.Duration, &filter.Hits); err != nil {
+			return filters, util.MakeError(err, "GetBoardFilters")
+		}
+
+		filters = append(filters, filter)
+	}
+
+	return filters, nil
+}
+
+func WriteBoardFilter(filter BoardFilter) error {
+	query := `insert into boardfilters (actor, regex, action, replacement, message, duration) values ($1, $2, $3, $4, $5, $6)`
+	_, err := config.DB.Exec(query, filter.Actor, filter.Regex, filter.Action, filter.Replacement, filter.Message, filter.Duration)
+
+	return util.MakeError(err, "WriteBoardFilter")
+}
+
+func DeleteBoardFilter(actor string, id int) error {
+	query := `delete from boardfilters where actor=$1 and id=$2`
+	_, err := config.DB.Exec(query, actor, id)
+
+	return util.MakeError(err, "DeleteBoardFilter")
+}
+
+func AddBoardFilterHit(id int) error {
+	query := `update boardfilters set hits=hits+1 where id=$1`
+	_, err := config.DB.Exec(query, id)
+
+	return util.MakeError(err, "AddBoardFilterHit")
+}
@@ -0,0 +1,164 @@
+package db
+
+import (
+	"html/template"
+	"time"
+
+	"github.com/FChannel0/FChannel-Server/config"
+	"github.com/FChannel0/FChannel-Server/util"
+)
+
+// BannedImage groups the perceptual hashes banned from a single file,
+// one hash for still images and several for animated gifs and videos.
+type BannedImage struct {
+	Id        string
+	Hashes    []uint64
+	Note      string
+	Thumbnail template.URL
+	Date      time.Time
+}
+
+type BannedHash struct {
+	Id   int
+	Hash string
+	Note string
+	Date time.Time
+}
+
+// BanImageHashes bans the perceptual hashes of a file, filehash is the content
+// hash of the file so federated posts with it can be matched by name.
+func BanImageHashes(hashes []uint64, filehash string, note string, thumbnail string) error {
+	mediaid := util.RandomID(16)
+
+	for _, hash := range hashes {
+		query := `insert into bannedimages (phash, filehash, mediaid, note, thumbnail, date) values ($1, $2, $3, $4, $5, $6) on conflict do nothing`
+		if _, err := config.DB.Exec(query, hash, filehash, mediaid, note, thumbnail, time.Now().UTC()); err != nil {
+			return util.MakeError(err, "BanImageHashes")
+		}
+	}
+
+	return nil
+}
+
+func BanMediaHash(hash string, filehash string, note string) error {
+	query := `insert into bannedmedia (hash, filehash, note, date) values ($1, $2, $3, $4)`
+	_, err := config.DB.Exec(query, hash, filehash, note, time.Now().UTC())
+
+	return util.MakeError(err, "BanMediaHash")
+}
+
+// IsFileHashBanned reports if a file with one of the content hashes was
+// banned.
+func IsFileHashBanned(hashes []string) (bool, error) {
+	var result bool
+
+	if len(hashes) == 0 {
+		return false, nil
+	}
+
+	query := `select exists (select 1 from bannedimages where filehash = ANY($1)) or exists (select 1 from bannedmedia where filehash = ANY($1))`
+	if err := config.DB.QueryRow(query, hashes).Scan(&result); err != nil {
+		return false, util.MakeError(err, "IsFileHashBanned")
+	}
+
+	return result, nil
+}
+
+func GetBannedPhashes() ([]uint64, error) {
+	var hashes []uint64
+
+	query := `select phash from bannedimages`
+	rows, err := config.DB.Query(query)
+
+	if err != nil {
+		return hashes, util.MakeError(err, "GetBannedPhashes")
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var phash uint64
+
+		if err := rows.Scan(&phash); err != nil {
+			return hashes, util.MakeError(err, "GetBannedPhashes")
+		}
+
+		hashes = append(hashes, phash)
+	}
+
+	return hashes, nil
+}
+
+func GetBannedImages() ([]BannedImage, error) {
+	var images []BannedImage
+
+	// bans from before hashes were grouped have no mediaid, use the hash instead
+	query := `select coalesce(mediaid, phash::text), phash, coalesce(note, ''), coalesce(thumbnail, ''), coalesce(date, timezone('utc', now())) from bannedimages order by date desc`
+	rows, err := config.DB.Query(query)
+
+	if err != nil {
+		return images, util.MakeError(err, "GetBannedImages")
+	}
+
+	var index = make(map[string]int)
+
+	defer rows.Close()
+	for rows.Next() {
+		var image BannedImage
+		var phash uint64
+		var thumbnail string
+
+		if err := rows.Scan(&image.Id, &phash, &image.Note, &thumbnail, &image.Date); err != nil {
+			return images, util.MakeError(err, "GetBannedImages")
+		}
+
+		if i, ok := index[image.Id]; ok {
+			images[i].Hashes = append(images[i].Hashes, phash)
+			continue
+		}
+
+		image.Hashes = []uint64{phash}
+		image.Thumbnail = template.URL(thumbnail)
+		index[image.Id] = len(images)
+		images = append(images, image)
+	}
+
+	return images, nil
+}
+
+func GetBannedHashes() ([]BannedHash, error) {
+	var hashes []BannedHash
+
+	query := `select id, hash, coalesce(note, ''), coalesce(date, timezone('utc', now())) from bannedmedia order by date desc`
+	rows, err := config.DB.Query(query)
+
+	if err != nil {
+		return hashes, util.MakeError(err, "GetBannedHashes")
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var hash BannedHash
+
+		if err := rows.Scan(&hash.Id, &hash.Hash, &hash.Note, &hash.Date); err != nil {
+			return hashes, util.MakeError(err, "GetBannedHashes")
+		}
+
+		hashes = append(hashes, hash)
+	}
+
+	return hashes, nil
+}
+
+func UnbanImage(id string) error {
+	query := `delete from bannedimages where mediaid=$1 or (mediaid is null and phash::text=$1)`
+	_, err := config.DB.Exec(query, id)
+
+	return util.MakeError(err, "UnbanImage")
+}
+
+func UnbanHash(id int) error {
+	query := `delete from bannedmedia where id=$1`
+	_, err := config.DB.Exec(query, id)
+
+	return util.MakeError(err, "UnbanHash")
+}
@@ -0,0 +1,107 @@
+package db
+
+import (
+	"time"
+
+	"github.com/FChannel0/FChannel-Server/config"
+	"github.com/FChannel0/FChannel-Server/util"
+)
+
+// The moderation log records what staff did, by whom and why. Boards can
+// show it publicly, without the IPs and private notes of the entries.
+
+const (
+	ModDelete        = "delete"
+	ModDeleteAttach  = "delete attachment"
+	ModMarkSensitive = "mark sensitive"
+	ModSticky        = "sticky"
+	ModLock          = "lock"
+	ModBan           = "ban"
+	ModBanMedia      = "ban media"
+	ModUnbanMedia    = "unban media"
+	ModBlacklist     = "blacklist"
+	ModUnblacklist   = "remove blacklist"
+	ModCloseReport   = "close report"
+	ModApprove       = "approve"
+	ModReject        = "reject"
+	ModAppeal        = "appeal"
+	ModWarn          = "warn"
+	ModNuke          = "nuke"
+)
+
+var ModActions = []string{ModDelete, ModDeleteAttach, ModMarkSensitive, ModSticky, ModLock, ModBan, ModBanMedia, ModUnbanMedia, ModBlacklist, ModUnblacklist, ModCloseReport, ModApprove, ModReject, ModAppeal, ModWarn, ModNuke}
+
+type ModLogEntry struct {
+	Id         int
+	Board      string
+	Identifier string
+	Label      string
+	Action     string
+	Target     string
+	Reason     string
+	Note       string
+	IP         string
+	Date       time.Time
+}
+
+// GetModLogStaff returns the identifier and label of the staff member with
+// the session code.
+func GetModLogStaff(code string) (string, string) {
+	var identifier, label string
+
+	query := `select identifier, coalesce(label, '') from boardaccess where code=$1`
+	if err := config.DB.QueryRow(query, code).Scan(&identifier, &label); err != nil {
+		return "", ""
+	}
+
+	return identifier, label
+}
+
+func WriteModLog(entry ModLogEntry) error {
+	for _, e := range []*string{&entry.Target, &entry.Reason, &entry.Note} {
+		if r := []rune(*e); len(r) > 512 {
+			*e = string(r[:512])
+		}
+	}
+
+	query := `insert into modlog (board, identifier, label, action, target, reason, note, ip) values ($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err := config.DB.Exec(query, entry.Board, entry.Identifier, entry.Label, entry.Action, entry.Target, entry.Reason, entry.Note, entry.IP)
+
+	return util.MakeError(err, "WriteModLog")
+}
+
+// GetModLog returns the newest entries of board, of every board if board is
+// empty, narrowed down to action and the staff member identifier when set.
+func GetModLog(board string, action string, identifier string, limit int) ([]ModLogEntry, error) {
+	var entries []ModLogEntry
+
+	query := `select id, board, identifier, label, action, target, reason, note, ip, date from modlog where ($1 = '' or board=$1) and ($2 = '' or action=$2) and ($3 = '' or identifier=$3) order by date desc limit $4`
+	rows, err := config.DB.Query(query, board, action, identifier, limit)
+
+	if err != nil {
+		return entries, util.MakeError(err, "GetModLog")
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var entry ModLogEntry
+
+		if err := rows.Scan(&entry.Id, &entry.Board, &entry.Identifier, &entry.Label, &entry.Action, &entry.Target, &entry.Reason, &entry.Note, &entry.IP, &entry.Date); err != nil {
+			return entries, util.MakeError(err, "GetModLog")
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// Redact returns entry as it is shown publicly, only naming staff by their
+// label.
+func (entry ModLogEntry) Redact() ModLogEntry {
+	entry.Identifier = ""
+	entry.Note = ""
+	entry.IP = ""
+
+	return entry
+}
@@ -0,0 +1,92 @@
+package db
+
+import (
+	"time"
+
+	"github.com/FChannel0/FChannel-Server/config"
+	"github.com/FChannel0/FChannel-Server/util"
+)
+
+// Warnings are given instead of bans. The poster is shown them on their next
+// attempt to post and can only post again once they acknowledged them.
+
+type Warning struct {
+	Id           int
+	IP           string
+	Board        string
+	Post         string
+	Message      string
+	Date         time.Time
+	Acknowledged bool
+}
+
+func WarnIP(warning Warning) error {
+	if r := []rune(warning.Message); len(r) > 512 {
+		warning.Message = string(r[:512])
+	}
+
+	query := `insert into warnings (ip, board, post, message) values ($1, $2, $3, $4)`
+	_, err := config.DB.Exec(query, warning.IP, warning.Board, warning.Post, warning.Message)
+
+	return util.MakeError(err, "WarnIP")
+}
+
+// GetUnacknowledgedWarnings returns the warnings ip has not acknowledged yet,
+// oldest first.
+func GetUnacknowledgedWarnings(ip string) ([]Warning, error) {
+	var warnings []Warning
+
+	query := `select id, ip, board, post, message, date, acknowledged from warnings where ip=$1::inet and acknowledged=false order by date asc`
+	rows, err := config.DB.Query(query, ip)
+
+	if err != nil {
+		return warnings, util.MakeError(err, "GetUnacknowledgedWarnings")
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var warning Warning
+
+		if err := rows.Scan(&warning.Id, &warning.IP, &warning.Board, &warning.Post, &warning.Message, &warning.Date, &warning.Acknowledged); err != nil {
+			return warnings, util.MakeError(err, "GetUnacknowledgedWarnings")
+		}
+
+		warnings = append(warnings, warning)
+	}
+
+	return warnings, nil
+}
+
+// AcknowledgeWarnings marks the warnings of ip up to id as read.
+func AcknowledgeWarnings(ip string, id int) error {
+	query := `update warnings set acknowledged=true where ip=$1::inet and id<=$2`
+	_, err := config.DB.Exec(query, ip, id)
+
+	return util.MakeError(err, "AcknowledgeWarnings")
+}
+
+// GetAllWarningsForIP returns the warnings given to ip or a range it is in,
+// newest first.
+func GetAllWarningsForIP(ip string) ([]Warning, error) {
+	var warnings []Warning
+
+	query := `select id, ip, board, post, message, date, acknowledged from warnings where $1 <<= ip order by date desc`
+	rows, err := config.DB.Query(query, ip)
+
+	if err != nil {
+		return warnings, util.MakeError(err, "GetAllWarningsForIP")
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var warning Warning
+
+		if err := rows.Scan(&warning.Id, &warning.IP, &warning.Board, &warning.Post, &warning.Message, &warning.Date, &warning.Acknowledged); err != nil {
+			return warnings, util.MakeError(err, "GetAllWarningsForIP")
+		}
+
+		warnings = append(warnings, warning)
+	}
+
+	return warnings, nil
+}
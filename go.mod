@@ -9,6 +9,7 @@ require (
 	github.com/gorilla/feeds v1.1.2
 	github.com/jackc/pgx/v5 v5.5.0
 	github.com/mikekonan/go-countries v1.1.2
+	github.com/nfnt/resize v0.0.0-20180221191011-83c6a9932646
 	github.com/oschwald/maxminddb-golang v1.12.0
 	github.com/simia-tech/crypt v0.5.1
 	gitlab.com/nyarla/go-crypt v0.0.0-20160106005555-d9a5dc2b789b
@@ -23,7 +24,6 @@ require (
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/mattn/go-runewidth v0.0.15 // indirect
-	github.com/nfnt/resize v0.0.0-20180221191011-83c6a9932646 // indirect
 	github.com/valyala/bytebufferpool v1.0.0 // indirect
 	github.com/valyala/tcplisten v1.0.0 // indirect
 	golang.org/x/net v0.17.0 // indirect
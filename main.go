@@ -7,8 +7,10 @@ import (
 	"github.com/FChannel0/FChannel-Server/activitypub"
 	"github.com/FChannel0/FChannel-Server/config"
 	"github.com/FChannel0/FChannel-Server/db"
+	"github.com/FChannel0/FChannel-Server/post"
 	"github.com/FChannel0/FChannel-Server/route"
 	"github.com/FChannel0/FChannel-Server/route/routes"
+	"github.com/FChannel0/FChannel-Server/storage"
 	"github.com/FChannel0/FChannel-Server/util"
 	"github.com/FChannel0/FChannel-Server/webfinger"
 	"github.com/gofiber/fiber/v2"
@@ -54,6 +56,7 @@ func main() {
 
 	app.Static("/static", "./views")
 	app.Static("/public", "./public")
+	app.Get("/public/:file", routes.PublicMedia)
 
 	// Main actor
 	app.Get("/", routes.Index)
@@ -73,11 +76,17 @@ func main() {
 	app.Get("/"+config.Key+"/newsdelete/:ts", routes.NewsDelete)
 	app.Post("/"+config.Key+"/:actor/addjanny", routes.AdminAddJanny)
 	app.Post("/"+config.Key+"/:actor/editsummary", routes.AdminEditSummary)
+	app.Post("/"+config.Key+"/:actor/cooldowns", routes.AdminEditCooldowns)
+	app.Post("/"+config.Key+"/:actor/spam", routes.AdminEditSpam)
+	app.Post("/"+config.Key+"/:actor/addfilter", routes.AdminAddFilter)
+	app.Get("/"+config.Key+"/:actor/deletefilter", routes.AdminDeleteFilter)
 	app.Get("/"+config.Key+"/:actor/deletejanny", routes.AdminDeleteJanny)
 	app.All("/"+config.Key+"/:actor/follow", routes.AdminFollow)
 	app.Get("/"+config.Key+"/:actor", routes.AdminActorIndex)
 
 	app.Get("/banned", routes.BannedGet)
+	app.Post("/banned", routes.BannedAppeal)
+	app.Post("/warning", routes.WarningAcknowledge)
 
 	// News routes
 	app.Get("/news/:ts", routes.NewsGet)
@@ -87,13 +96,25 @@ func main() {
 	// Board managment
 	app.Get("/ban", routes.BanGet)
 	app.Post("/ban", routes.BanPost)
+	app.Post("/appeal", routes.AppealPost)
+	app.Get("/nuke", routes.NukeGet)
+	app.Post("/nuke", routes.NukePost)
 	app.Get("/banmedia", routes.BoardBanMedia)
+	app.Get("/unbanmedia", routes.BoardUnbanMedia)
 	app.Get("/delete", routes.BoardDelete)
 	app.Get("/deleteattach", routes.BoardDeleteAttach)
 	app.Get("/marksensitive", routes.BoardMarkSensitive)
 	app.Get("/addtoindex", routes.BoardAddToIndex)
 	app.Get("/poparchive", routes.BoardPopArchive)
 	app.Get("/autosubscribe", routes.BoardAutoSubscribe)
+	app.Get("/posterids", routes.BoardPosterIDs)
+	app.Get("/flags", routes.BoardFlags)
+	app.Get("/dice", routes.BoardDice)
+	app.Get("/r9k", routes.BoardR9K)
+	app.Get("/premoderation", routes.BoardPremoderation)
+	app.Get("/publicmodlog", routes.BoardPublicModLog)
+	app.Get("/approve", routes.BoardApprove)
+	app.Get("/reject", routes.BoardReject)
 	app.All("/blacklist", routes.BoardBlacklist)
 	app.All("/report", routes.ReportPost)
 	app.Get("/make-report", routes.ReportGet)
@@ -101,6 +122,7 @@ func main() {
 	app.Get("/lock", routes.Lock)
 
 	app.Post("/multidelete", routes.MultiDelete)
+	app.Post("/vote", routes.PollVote)
 
 	// Webfinger routes
 	app.Get("/.well-known/webfinger", routes.Webfinger)
@@ -121,6 +143,7 @@ func main() {
 	app.Get("/:actor/following", routes.ActorFollowing)
 	app.Get("/:actor/followers", routes.ActorFollowers)
 	app.Get("/:actor/archive", routes.ActorArchive)
+	app.Get("/:actor/modlog", routes.ActorModLog)
 	app.Get("/:actor/feed.:feedtype", routes.GetBoardFeed)
 	app.Get("/f", routes.ActorFlash)
 	app.Get("/:actor", routes.ActorPosts)
@@ -145,6 +168,10 @@ func Init() {
 		config.Log.Println(err)
 	}
 
+	if err = storage.Init(); err != nil {
+		config.Log.Println(err)
+	}
+
 	if err = db.Connect(); err != nil {
 		config.Log.Println(err)
 	}
@@ -157,6 +184,10 @@ func Init() {
 		config.Log.Println(err)
 	}
 
+	activitypub.SpamCheck = post.CheckFederatedSpam
+	activitypub.ParseQuotes = post.ContentQuotes
+	activitypub.BoardLinkHref = post.BoardLinkHref
+
 	if actor, err = activitypub.GetActorFromDB(config.Domain); err != nil {
 		config.Log.Println(err)
 	}
@@ -181,6 +212,8 @@ func Init() {
 
 	go webfinger.StartupArchive()
 
+	go activitypub.BackfillBacklinks()
+
 	go util.MakeCaptchas(100)
 
 	go db.CheckInactive()
@@ -0,0 +1,142 @@
+package post
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+
+	"github.com/FChannel0/FChannel-Server/activitypub"
+	"github.com/FChannel0/FChannel-Server/config"
+	"github.com/FChannel0/FChannel-Server/util"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Cooldowns limit how often a poster can start threads, reply and post the
+// same comment on a board. They are kept in the database until they expire so
+// they hold across bursts of requests and restarts.
+
+const ThreadCooldown = "thread"
+const ReplyCooldown = "reply"
+const DuplicateCooldown = "duplicate"
+
+func cooldownHash(value string) string {
+	hasher := sha256.New()
+	hasher.Write([]byte(config.Salt + value))
+
+	return base64.URLEncoding.EncodeToString(hasher.Sum(nil))
+}
+
+// CooldownPosters returns the keys the cooldowns of the poster of ctx are
+// kept under, the IP of the poster and the token of the request if it has one.
+func CooldownPosters(ctx *fiber.Ctx) []string {
+	ip := ctx.Get("PosterIP")
+	if ip == "" {
+		ip = ctx.IP()
+	}
+
+	posters := []string{cooldownHash("ip:" + ip)}
+
+	if token := ctx.Get("Authorization"); token != "" {
+		posters = append(posters, cooldownHash("token:"+token))
+	} else if token := ctx.Cookies("session_token"); token != "" {
+		posters = append(posters, cooldownHash("token:"+token))
+	}
+
+	return posters
+}
+
+func commentHash(comment string) string {
+	comment = strings.ToLower(strings.Join(strings.Fields(comment), " "))
+
+	if comment == "" {
+		return ""
+	}
+
+	return cooldownHash("comment:" + comment)
+}
+
+// GetCooldown returns the seconds left of the longest cooldown of posters on
+// actor for a thread or reply with comment, and the kind of cooldown.
+func GetCooldown(actor activitypub.Actor, posters []string, reply bool, comment string) (int, string, error) {
+	var left int
+	var _type string
+
+	postType := ThreadCooldown
+	if reply {
+		postType = ReplyCooldown
+	}
+
+	query := `select type, ceil(extract(epoch from (expires - NOW())))::int from cooldowns where actor=$1 and poster = ANY($2) and expires > NOW() and (type=$3 or (type=$4 and hash=$5 and hash != '')) order by expires desc limit 1`
+	rows, err := config.DB.Query(query, actor.Id, posters, postType, DuplicateCooldown, commentHash(comment))
+
+	if err != nil {
+		return 0, "", util.MakeError(err, "GetCooldown")
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		if err := rows.Scan(&_type, &left); err != nil {
+			return 0, "", util.MakeError(err, "GetCooldown")
+		}
+	}
+
+	return left, _type, nil
+}
+
+// WriteCooldowns starts the cooldowns of posters on actor after a thread or
+// reply with comment was made.
+func WriteCooldowns(actor activitypub.Actor, posters []string, reply bool, comment string) error {
+	thread, replies, duplicate, err := actor.GetCooldowns()
+
+	if err != nil {
+		return util.MakeError(err, "WriteCooldowns")
+	}
+
+	query := `delete from cooldowns where expires < NOW()`
+	if _, err := config.DB.Exec(query); err != nil {
+		return util.MakeError(err, "WriteCooldowns")
+	}
+
+	postType, seconds := ThreadCooldown, thread
+	if reply {
+		postType, seconds = ReplyCooldown, replies
+	}
+
+	hash := commentHash(comment)
+
+	for _, e := range posters {
+		if seconds > 0 {
+			query := `insert into cooldowns (actor, poster, type, expires) values ($1, $2, $3, NOW() + $4::int * interval '1 second')`
+			if _, err := config.DB.Exec(query, actor.Id, e, postType, seconds); err != nil {
+				return util.MakeError(err, "WriteCooldowns")
+			}
+		}
+
+		if duplicate > 0 && hash != "" {
+			query := `insert into cooldowns (actor, poster, type, hash, expires) values ($1, $2, $3, $4, NOW() + $5::int * interval '1 second')`
+			if _, err := config.DB.Exec(query, actor.Id, e, DuplicateCooldown, hash, duplicate); err != nil {
+				return util.MakeError(err, "WriteCooldowns")
+			}
+		}
+	}
+
+	return nil
+}
+
+// CooldownMessage returns the error shown for a post rejected by a cooldown.
+func CooldownMessage(left int, _type string) string {
+	wait := strconv.Itoa(left) + " seconds"
+	if left == 1 {
+		wait = "1 second"
+	}
+
+	switch _type {
+	case ThreadCooldown:
+		return "Please wait " + wait + " before starting another thread"
+	case DuplicateCooldown:
+		return "Please wait " + wait + " before posting the same comment again"
+	}
+
+	return "Please wait " + wait + " before replying again"
+}
@@ -0,0 +1,71 @@
+package post
+
+import (
+	"regexp"
+
+	"github.com/FChannel0/FChannel-Server/activitypub"
+	"github.com/FChannel0/FChannel-Server/db"
+	"github.com/FChannel0/FChannel-Server/util"
+)
+
+// MatchFilters returns text with the replace filters of filters applied, and
+// every filter that matched it. Filters that do not compile are skipped.
+func MatchFilters(filters []db.BoardFilter, text string) (string, []db.BoardFilter) {
+	var matched []db.BoardFilter
+
+	for _, e := range filters {
+		re, err := regexp.Compile(e.Regex)
+
+		if err != nil || !re.MatchString(text) {
+			continue
+		}
+
+		if e.Action == db.FilterReplace {
+			text = re.ReplaceAllString(text, e.Replacement)
+		}
+
+		matched = append(matched, e)
+	}
+
+	return text, matched
+}
+
+// FilterPost applies the filters of actor to the subject and comment of obj as
+// they were posted, before escaping, so filters match what the poster wrote.
+// It returns obj with the escaped subject and comment with the replace filters
+// applied and the first matching filter with another action, which has an Id
+// of 0 if none matched.
+func FilterPost(actor activitypub.Actor, obj activitypub.ObjectBase, subject string, comment string) (activitypub.ObjectBase, db.BoardFilter, error) {
+	var filter db.BoardFilter
+
+	filters, err := db.GetBoardFilters(actor.Id)
+
+	if err != nil {
+		return obj, filter, util.MakeError(err, "FilterPost")
+	}
+
+	var name, content []db.BoardFilter
+
+	subject, name = MatchFilters(filters, subject)
+	comment, content = MatchFilters(filters, comment)
+
+	obj.Name = util.EscapeString(subject)
+	obj.Content = util.EscapeString(comment)
+
+	hit := map[int]bool{}
+	for _, e := range append(name, content...) {
+		if !hit[e.Id] {
+			if err := db.AddBoardFilterHit(e.Id); err != nil {
+				return obj, filter, util.MakeError(err, "FilterPost")
+			}
+
+			hit[e.Id] = true
+		}
+
+		if filter.Id == 0 && e.Action != db.FilterReplace {
+			filter = e
+		}
+	}
+
+	return obj, filter, nil
+}
@@ -0,0 +1,429 @@
+package post
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Comments are parsed into a tree before rendering so markup always nests
+// correctly, code blocks are left untouched and all user text is escaped
+// exactly once. The supported markup is
+//
+//	>greentext and <pinktext lines
+//	[spoiler], [b], [i], [s] and [code] tags
+//	>>https://instance/board/id quotes of other posts
+//	>>>/board/, >>>/board/id and >>>/board@instance/ links to other boards
+//	http and https links
+
+type NodeType int
+
+const (
+	TextNode NodeType = iota
+	NewlineNode
+	GreentextNode
+	PinktextNode
+	SpoilerNode
+	CodeNode
+	BoldNode
+	ItalicNode
+	StrikeNode
+	QuoteNode
+	LinkNode
+	BoardLinkNode
+)
+
+// Node is an element of a parsed comment. Text holds the text of text and
+// code nodes, the quoted post of quote nodes, the url of link nodes and the
+// link as written without >>> of board link nodes.
+type Node struct {
+	Type     NodeType
+	Text     string
+	Children []*Node
+}
+
+// LinkRenderer returns the output for a quote or board link node.
+type LinkRenderer func(node *Node) string
+
+var markupTags = map[string]NodeType{
+	"spoiler": SpoilerNode,
+	"b":       BoldNode,
+	"i":       ItalicNode,
+	"s":       StrikeNode,
+}
+
+var markupTagRe = regexp.MustCompile(`^\[(/)?(spoiler|code|b|i|s)\]`)
+var quoteLinkRe = regexp.MustCompile(`^>>(https?://[A-Za-z0-9_.:\-~]+\/[A-Za-z0-9_.\-~]+\/)(f[A-Za-z0-9_.\-~]+-)?([A-Za-z0-9_.\-~]+)?#?([A-Za-z0-9_.\-~]+)?`)
+var boardLinkRe = regexp.MustCompile(`^>>>/([A-Za-z0-9_]+)(@[A-Za-z0-9.:\-]+)?/([A-Za-z0-9]+)?`)
+var linkRe = regexp.MustCompile(`^https?://[^\s<>"'\[\]]+`)
+
+type markupParser struct {
+	stack []*Node
+}
+
+// ParseMarkup parses a comment into a list of nodes.
+func ParseMarkup(content string) []*Node {
+	// comments are stored with < escaped by util.EscapeString, the renderers
+	// escape everything themselves
+	content = strings.ReplaceAll(content, "&lt;", "<")
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	content = strings.ReplaceAll(content, "\r", "\n")
+
+	root := &Node{}
+	p := markupParser{stack: []*Node{root}}
+	lineStart := true
+
+	for i := 0; i < len(content); {
+		s := content[i:]
+
+		if lineStart {
+			lineStart = false
+
+			if s[0] == '>' && !quoteLinkRe.MatchString(s) && !boardLinkRe.MatchString(s) {
+				p.open(GreentextNode)
+			} else if s[0] == '<' {
+				p.open(PinktextNode)
+			}
+		}
+
+		switch {
+		case s[0] == '\n':
+			p.newline()
+			lineStart = true
+			i++
+			continue
+
+		case s[0] == '[':
+			match := markupTagRe.FindStringSubmatch(s)
+
+			if match == nil {
+				break
+			}
+
+			if match[2] == "code" {
+				end := strings.Index(s, "[/code]")
+
+				if match[1] != "" || end < 0 {
+					break
+				}
+
+				p.append(&Node{Type: CodeNode, Text: s[len(match[0]):end]})
+				i += end + len("[/code]")
+				continue
+			}
+
+			if match[1] == "" {
+				p.open(markupTags[match[2]])
+				i += len(match[0])
+				continue
+			}
+
+			if p.close(markupTags[match[2]]) {
+				i += len(match[0])
+				continue
+			}
+
+		case s[0] == '>':
+			if match := boardLinkRe.FindString(s); match != "" {
+				p.append(&Node{Type: BoardLinkNode, Text: strings.TrimPrefix(match, ">>>")})
+				i += len(match)
+				continue
+			}
+
+			if match := quoteLinkRe.FindString(s); match != "" {
+				p.append(&Node{Type: QuoteNode, Text: strings.TrimPrefix(match, ">>")})
+				i += len(match)
+				continue
+			}
+
+		case s[0] == 'h' && (i == 0 || strings.ContainsRune(" \t\n(", rune(content[i-1]))):
+			if match := strings.TrimRight(linkRe.FindString(s), ".,;:!?)"); len(match) > len("https://") {
+				p.append(&Node{Type: LinkNode, Text: match})
+				i += len(match)
+				continue
+			}
+		}
+
+		// plain text up to the next character that could start markup
+		n := strings.IndexAny(s[1:], "\n[>h")
+		if n < 0 {
+			n = len(s)
+		} else {
+			n++
+		}
+
+		p.text(s[:n])
+		i += n
+	}
+
+	return root.Children
+}
+
+func (p *markupParser) top() *Node {
+	return p.stack[len(p.stack)-1]
+}
+
+func (p *markupParser) append(node *Node) {
+	top := p.top()
+	top.Children = append(top.Children, node)
+}
+
+func (p *markupParser) text(text string) {
+	top := p.top()
+
+	if n := len(top.Children); n > 0 && top.Children[n-1].Type == TextNode {
+		top.Children[n-1].Text += text
+		return
+	}
+
+	p.append(&Node{Type: TextNode, Text: text})
+}
+
+func (p *markupParser) open(t NodeType) {
+	node := &Node{Type: t}
+	p.append(node)
+	p.stack = append(p.stack, node)
+}
+
+// close ends the innermost open node of type t. Nodes opened after it are
+// closed with it and opened again so they carry on after the closing tag. It
+// returns false if no node of type t is open.
+func (p *markupParser) close(t NodeType) bool {
+	for i := len(p.stack) - 1; i > 0; i-- {
+		if p.stack[i].Type != t {
+			continue
+		}
+
+		reopen := p.stack[i+1:]
+		p.stack = p.stack[:i]
+
+		for _, e := range reopen {
+			p.open(e.Type)
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// newline ends the current greentext or pinktext line, markup opened on the
+// line carries on to the next one.
+func (p *markupParser) newline() {
+	for i := len(p.stack) - 1; i > 0; i-- {
+		if t := p.stack[i].Type; t != GreentextNode && t != PinktextNode {
+			continue
+		}
+
+		reopen := p.stack[i+1:]
+		p.stack = p.stack[:i]
+		p.append(&Node{Type: NewlineNode})
+
+		for _, e := range reopen {
+			p.open(e.Type)
+		}
+
+		return
+	}
+
+	p.append(&Node{Type: NewlineNode})
+}
+
+// TruncateMarkup returns the nodes before the line break ending line lines,
+// and whether anything was cut off.
+func TruncateMarkup(nodes []*Node, lines int) ([]*Node, bool) {
+	if countLines(nodes) <= lines {
+		return nodes, false
+	}
+
+	return truncateNodes(nodes, &lines), true
+}
+
+func countLines(nodes []*Node) int {
+	var count int
+
+	for _, e := range nodes {
+		switch e.Type {
+		case NewlineNode:
+			count++
+		case CodeNode:
+			count += strings.Count(e.Text, "\n")
+		default:
+			count += countLines(e.Children)
+		}
+	}
+
+	return count
+}
+
+func truncateNodes(nodes []*Node, lines *int) []*Node {
+	var result []*Node
+
+	for _, e := range nodes {
+		if *lines <= 0 {
+			break
+		}
+
+		switch e.Type {
+		case NewlineNode:
+			if *lines--; *lines <= 0 {
+				return result
+			}
+
+			result = append(result, e)
+		case CodeNode:
+			code := strings.SplitAfter(e.Text, "\n")
+
+			if len(code)-1 >= *lines {
+				result = append(result, &Node{Type: CodeNode, Text: strings.TrimSuffix(strings.Join(code[:*lines], ""), "\n")})
+				*lines = 0
+				return result
+			}
+
+			*lines -= len(code) - 1
+			result = append(result, e)
+		default:
+			node := *e
+			node.Children = truncateNodes(e.Children, lines)
+			result = append(result, &node)
+		}
+	}
+
+	return result
+}
+
+// RenderHTML renders nodes as escaped html. link renders quotes and board
+// links, if it is nil DefaultLinkHTML is used.
+func RenderHTML(nodes []*Node, link LinkRenderer) string {
+	var b strings.Builder
+
+	if link == nil {
+		link = DefaultLinkHTML
+	}
+
+	renderHTML(&b, nodes, link)
+
+	return b.String()
+}
+
+// DefaultLinkHTML renders quotes as plain links to the quoted post and board
+// links as text.
+func DefaultLinkHTML(node *Node) string {
+	if node.Type == QuoteNode {
+		return "<a class=\"reply\" href=\"" + html.EscapeString(node.Text) + "\">&gt;&gt;" + html.EscapeString(node.Text) + "</a>"
+	}
+
+	return "&gt;&gt;&gt;" + html.EscapeString(node.Text)
+}
+
+func renderHTML(b *strings.Builder, nodes []*Node, link LinkRenderer) {
+	for _, e := range nodes {
+		switch e.Type {
+		case TextNode:
+			b.WriteString(html.EscapeString(e.Text))
+		case NewlineNode:
+			b.WriteString("\n")
+		case CodeNode:
+			b.WriteString("<pre class='prettyprint'>" + html.EscapeString(e.Text) + "</pre>")
+		case QuoteNode, BoardLinkNode:
+			b.WriteString(link(e))
+		case LinkNode:
+			b.WriteString("<a href=\"" + html.EscapeString(e.Text) + "\" rel=\"nofollow noopener noreferrer\" target=\"_blank\">" + html.EscapeString(e.Text) + "</a>")
+		default:
+			// tags reopened after a line break or closing tag can be empty
+			if len(e.Children) == 0 {
+				continue
+			}
+
+			open, close := markupElement(e.Type)
+			b.WriteString(open)
+			renderHTML(b, e.Children, link)
+			b.WriteString(close)
+		}
+	}
+}
+
+func markupElement(t NodeType) (string, string) {
+	switch t {
+	case GreentextNode:
+		return "<span class=\"quote\">", "</span>"
+	case PinktextNode:
+		return "<span class=\"pinktext\">", "</span>"
+	case SpoilerNode:
+		return "<s>", "</s>"
+	case BoldNode:
+		return "<b>", "</b>"
+	case ItalicNode:
+		return "<i>", "</i>"
+	case StrikeNode:
+		return "<del>", "</del>"
+	}
+
+	return "", ""
+}
+
+// RenderText renders nodes as plain text without markup. link renders quotes
+// and board links, if it is nil they are rendered as written.
+func RenderText(nodes []*Node, link LinkRenderer) string {
+	var b strings.Builder
+
+	if link == nil {
+		link = func(node *Node) string {
+			if node.Type == QuoteNode {
+				return ">>" + node.Text
+			}
+
+			return ">>>" + node.Text
+		}
+	}
+
+	renderText(&b, nodes, link)
+
+	return b.String()
+}
+
+func renderText(b *strings.Builder, nodes []*Node, link LinkRenderer) {
+	for _, e := range nodes {
+		switch e.Type {
+		case TextNode, CodeNode, LinkNode:
+			b.WriteString(e.Text)
+		case NewlineNode:
+			b.WriteString("\n")
+		case QuoteNode, BoardLinkNode:
+			b.WriteString(link(e))
+		default:
+			renderText(b, e.Children, link)
+		}
+	}
+}
+
+// MarkupQuotes returns the posts quoted in nodes, quotes inside code blocks
+// are not parsed so they are not included.
+func MarkupQuotes(nodes []*Node) []string {
+	var links []string
+
+	for _, e := range nodes {
+		if e.Type == QuoteNode {
+			links = append(links, e.Text)
+		}
+
+		links = append(links, MarkupQuotes(e.Children)...)
+	}
+
+	return links
+}
+
+// MarkupBoardLinks returns the board links in nodes as written without >>>.
+func MarkupBoardLinks(nodes []*Node) []string {
+	var links []string
+
+	for _, e := range nodes {
+		if e.Type == BoardLinkNode {
+			links = append(links, e.Text)
+		}
+
+		links = append(links, MarkupBoardLinks(e.Children)...)
+	}
+
+	return links
+}
@@ -0,0 +1,202 @@
+package post
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/FChannel0/FChannel-Server/util"
+)
+
+var markupSeeds = []string{
+	"",
+	"plain text",
+	"[spoiler]a [b]bold [i]nested[/i][/b] spoiler[/spoiler]",
+	"[spoiler][spoiler]double[/spoiler][/spoiler]",
+	"[code]<script>alert(1)</script>[/code]",
+	"[code][spoiler]not markup[/spoiler] >>https://example.com/g/abc[/code]",
+	">greentext [spoiler]with spoiler\nnext line[/spoiler]",
+	"<pinktext [b]bold\n>greentext[/b]",
+	">>https://example.com/g/abc [s]quote[/s]",
+	">>>/g/ >>>/g@example.com/abc",
+	"https://example.com/?a=<b>&c=\"d\"",
+	"[spoiler]unterminated",
+	"[code]unterminated",
+	"[/b]closed before open[b]",
+	"[b][i]crossed[/b][/i]",
+	"&lt;script&gt; <\"'>",
+	"\r\n>\r<\r\n[",
+}
+
+// generated tags, hrefs are escaped so they never contain < or >
+var markupHTMLTagRe = regexp.MustCompile(`^<(/?)(span|s|b|i|del|pre|a)(?: class="quote"| class="pinktext"| class='prettyprint'| class="reply" href="[^"<>]*"| href="[^"<>]*" rel="nofollow noopener noreferrer" target="_blank")?>$`)
+
+// checkMarkupHTML fails t if out has a < or > outside the generated tags or
+// the tags are not balanced.
+func checkMarkupHTML(t *testing.T, input string, out string) {
+	var stack []string
+
+	for i := 0; i < len(out); i++ {
+		switch out[i] {
+		case '>':
+			t.Fatalf("unescaped > at %d rendering %q: %q", i, input, out)
+		case '<':
+			end := strings.IndexByte(out[i:], '>')
+			if end < 0 {
+				t.Fatalf("unescaped < at %d rendering %q: %q", i, input, out)
+			}
+
+			tag := out[i : i+end+1]
+			match := markupHTMLTagRe.FindStringSubmatch(tag)
+			if match == nil {
+				t.Fatalf("unexpected tag %q rendering %q: %q", tag, input, out)
+			}
+
+			if match[1] == "" {
+				stack = append(stack, match[2])
+			} else {
+				if len(stack) == 0 || stack[len(stack)-1] != match[2] {
+					t.Fatalf("unbalanced %q rendering %q: %q", tag, input, out)
+				}
+
+				stack = stack[:len(stack)-1]
+			}
+
+			i += end
+		}
+	}
+
+	if len(stack) > 0 {
+		t.Fatalf("unclosed tags %v rendering %q: %q", stack, input, out)
+	}
+}
+
+func FuzzParseMarkup(f *testing.F) {
+	for _, e := range markupSeeds {
+		f.Add(e, 2)
+	}
+
+	f.Fuzz(func(t *testing.T, content string, lines int) {
+		nodes := ParseMarkup(content)
+
+		RenderText(nodes, nil)
+		MarkupQuotes(nodes)
+		MarkupBoardLinks(nodes)
+
+		if lines %= 50; lines < 0 {
+			lines = -lines
+		}
+
+		truncated, _ := TruncateMarkup(nodes, lines)
+		checkMarkupHTML(t, content, RenderHTML(truncated, nil))
+	})
+}
+
+func FuzzRenderHTML(f *testing.F) {
+	for _, e := range markupSeeds {
+		f.Add(e)
+	}
+
+	f.Fuzz(func(t *testing.T, content string) {
+		checkMarkupHTML(t, content, RenderHTML(ParseMarkup(content), nil))
+	})
+}
+
+// markupTests are rendered from comments as they are stored, with < escaped by
+// util.EscapeString, and truncated to two lines once they have more than two
+// line breaks.
+var markupTests = []struct {
+	name      string
+	comment   string
+	html      string
+	truncated string
+	cut       bool
+}{
+	{
+		name:      "plain",
+		comment:   "plain text",
+		html:      "plain text",
+		truncated: "plain text",
+	},
+	{
+		name:      "greentext",
+		comment:   ">greentext\nnormal",
+		html:      `<span class="quote">&gt;greentext</span>` + "\nnormal",
+		truncated: `<span class="quote">&gt;greentext</span>` + "\nnormal",
+	},
+	{
+		name:      "pinktext",
+		comment:   "<pinktext",
+		html:      `<span class="pinktext">&lt;pinktext</span>`,
+		truncated: `<span class="pinktext">&lt;pinktext</span>`,
+	},
+	{
+		name:      "escaped html",
+		comment:   "<b>hi</b> & <i>",
+		html:      `<span class="pinktext">&lt;b&gt;hi&lt;/b&gt; &amp; &lt;i&gt;</span>`,
+		truncated: `<span class="pinktext">&lt;b&gt;hi&lt;/b&gt; &amp; &lt;i&gt;</span>`,
+	},
+	{
+		name:      "spoiler",
+		comment:   ">green\n[spoiler]a\nb\nc[/spoiler]",
+		html:      `<span class="quote">&gt;green</span>` + "\n<s>a\nb\nc</s>",
+		truncated: `<span class="quote">&gt;green</span>` + "\n<s>a</s>",
+		cut:       true,
+	},
+	{
+		name:      "formatting",
+		comment:   "[b]bold[/b] [i]it[/i] [s]s[/s]",
+		html:      "<b>bold</b> <i>it</i> <del>s</del>",
+		truncated: "<b>bold</b> <i>it</i> <del>s</del>",
+	},
+	{
+		name:      "code",
+		comment:   "[code]<b>x</b> >>https://example.com/g/abc\n[spoiler]y[/spoiler]\nz\nw[/code]",
+		html:      "<pre class='prettyprint'>&lt;b&gt;x&lt;/b&gt; &gt;&gt;https://example.com/g/abc\n[spoiler]y[/spoiler]\nz\nw</pre>",
+		truncated: "<pre class='prettyprint'>&lt;b&gt;x&lt;/b&gt; &gt;&gt;https://example.com/g/abc\n[spoiler]y[/spoiler]</pre>",
+		cut:       true,
+	},
+	{
+		name:      "quote",
+		comment:   ">>https://example.com/g/abc",
+		html:      `<a class="reply" href="https://example.com/g/abc">&gt;&gt;https://example.com/g/abc</a>`,
+		truncated: `<a class="reply" href="https://example.com/g/abc">&gt;&gt;https://example.com/g/abc</a>`,
+	},
+	{
+		name:      "board link without a tag",
+		comment:   ">>>/g/",
+		html:      "&gt;&gt;&gt;/g/",
+		truncated: "&gt;&gt;&gt;/g/",
+	},
+	{
+		name:      "link",
+		comment:   "see https://example.com/?a=1&b=\"2\"",
+		html:      `see <a href="https://example.com/?a=1&amp;b=" rel="nofollow noopener noreferrer" target="_blank">https://example.com/?a=1&amp;b=</a>&#34;2&#34;`,
+		truncated: `see <a href="https://example.com/?a=1&amp;b=" rel="nofollow noopener noreferrer" target="_blank">https://example.com/?a=1&amp;b=</a>&#34;2&#34;`,
+	},
+	{
+		name:      "lines",
+		comment:   "a\nb\nc\nd",
+		html:      "a\nb\nc\nd",
+		truncated: "a\nb",
+		cut:       true,
+	},
+}
+
+func TestRenderHTML(t *testing.T) {
+	for _, e := range markupTests {
+		t.Run(e.name, func(t *testing.T) {
+			nodes := ParseMarkup(util.EscapeString(e.comment))
+
+			if out := RenderHTML(nodes, nil); out != e.html {
+				t.Errorf("RenderHTML(%q) = %q, want %q", e.comment, out, e.html)
+			}
+
+			truncated, cut := TruncateMarkup(nodes, 2)
+
+			if out := RenderHTML(truncated, nil); out != e.truncated || cut != e.cut {
+				t.Errorf("TruncateMarkup(%q) = %q, %v, want %q, %v", e.comment, out, cut, e.truncated, e.cut)
+			}
+		})
+	}
+}
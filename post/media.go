@@ -0,0 +1,480 @@
+package post
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"html/template"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/FChannel0/FChannel-Server/activitypub"
+	"github.com/FChannel0/FChannel-Server/config"
+	"github.com/FChannel0/FChannel-Server/util"
+	"github.com/corona10/goimagehash"
+	"github.com/nfnt/resize"
+)
+
+// MediaFrames returns the frames of f used for perceptual hashing. Still images
+// return a single frame, animated gifs and videos return up to
+// config.PhashFrames frames. The file is rewound before returning.
+func MediaFrames(f multipart.File) ([]image.Image, error) {
+	var frames []image.Image
+	var err error
+
+	mimetype, _ := util.GetFileContentType(f)
+
+	switch mimetype {
+	case "image/gif":
+		frames, err = gifFrames(f)
+	case "image/jpeg", "image/png":
+		var img image.Image
+		if img, err = decodeImage(f); err == nil {
+			frames = append(frames, img)
+		}
+	case "video/mp4", "video/webm", "video/ogg":
+		frames, err = videoFrames(f)
+	}
+
+	f.Seek(0, 0)
+
+	if err != nil {
+		return frames, util.MakeError(err, "MediaFrames")
+	}
+
+	return frames, nil
+}
+
+// MediaHashes returns the perceptual hash of each frame.
+func MediaHashes(frames []image.Image) []uint64 {
+	var hashes []uint64
+
+	for _, frame := range frames {
+		phash, err := goimagehash.PerceptionHash(frame)
+
+		if err != nil {
+			continue
+		}
+
+		hashes = append(hashes, phash.GetHash())
+	}
+
+	return hashes
+}
+
+// MediaThumbnail returns a small jpeg of img as a data URI, so moderators can
+// see banned media after the original file has been removed.
+func MediaThumbnail(img image.Image) (string, error) {
+	var buf bytes.Buffer
+
+	thumb := resize.Thumbnail(150, 150, img, resize.Bilinear)
+
+	if err := jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 70}); err != nil {
+		return "", util.MakeError(err, "MediaThumbnail")
+	}
+
+	return "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// MediaInfo returns the width, height, duration and blurhash of the local file
+// src. Values that do not apply to mediatype or could not be read are left
+// empty.
+func MediaInfo(src string, mediatype string) (int, int, string, string) {
+	var width, height int
+	var duration, blurhash string
+
+	if strings.HasPrefix(mediatype, "video/") || strings.HasPrefix(mediatype, "audio/") {
+		duration = mediaDuration(src)
+	}
+
+	if !strings.HasPrefix(mediatype, "image/") && !strings.HasPrefix(mediatype, "video/") {
+		return width, height, duration, blurhash
+	}
+
+	img, err := firstFrame(src)
+
+	if err != nil {
+		config.Log.Println(util.MakeError(err, "MediaInfo"))
+		return width, height, duration, blurhash
+	}
+
+	width, height = img.Bounds().Dx(), img.Bounds().Dy()
+
+	// the hash only keeps a few components, encoding a thumbnail is plenty
+	thumb := resize.Thumbnail(64, 64, img, resize.Bilinear)
+	blurhash, _ = util.BlurhashEncode(thumb, 4, 3)
+
+	return width, height, duration, blurhash
+}
+
+// mediaDuration returns the length of src as an xsd:duration, the format
+// ActivityStreams uses for duration.
+func mediaDuration(src string) string {
+	out, err := exec.Command("ffprobe", "-v", "error", "-show_entries", "format=duration", "-of", "default=noprint_wrappers=1:nokey=1", src).Output()
+
+	if err != nil {
+		return ""
+	}
+
+	seconds, err := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+
+	if err != nil || seconds <= 0 {
+		return ""
+	}
+
+	return "PT" + strconv.FormatFloat(seconds, 'f', 3, 64) + "S"
+}
+
+// firstFrame decodes src with the standard library if it can, otherwise the
+// first frame is extracted with ffmpeg which also handles webp and video.
+func firstFrame(src string) (image.Image, error) {
+	f, err := os.Open(src)
+
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := decodeImage(f)
+	f.Close()
+
+	if err == nil || errors.Is(err, errImageTooLarge) {
+		return img, err
+	}
+
+	dir, err := os.MkdirTemp("", "fchan-frames")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.RemoveAll(dir)
+
+	frame := filepath.Join(dir, "frame.png")
+
+	if err := exec.Command("ffmpeg", "-loglevel", "error", "-i", src, "-frames:v", "1", frame).Run(); err != nil {
+		return nil, err
+	}
+
+	if f, err = os.Open(frame); err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	return decodeImage(f)
+}
+
+// images larger than this are not decoded, a small file can declare enough
+// pixels to run the server out of memory
+const maxImagePixels = 8192 * 8192
+
+var errImageTooLarge = errors.New("image is too large")
+
+// decodeImage decodes r after checking its dimensions are within
+// maxImagePixels.
+func decodeImage(r io.ReadSeeker) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > maxImagePixels {
+		return nil, errImageTooLarge
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(r)
+
+	return img, err
+}
+
+// MediaSize returns css reserving the space attachment takes once shown scaled
+// down to fit max, or an empty string if its dimensions are unknown.
+func MediaSize(attachment activitypub.ObjectBase, max int) string {
+	width, height := fitSize(attachment.Width, attachment.Height, max)
+
+	if width == 0 || height == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("width: %dpx; height: %dpx; ", width, height)
+}
+
+// SensitivePreview returns the placeholder shown in place of sensitive media,
+// the attachment blurhash rendered as a small png if it has one.
+func SensitivePreview(attachment activitypub.ObjectBase) template.URL {
+	if attachment.Blurhash == "" {
+		return "/static/sensitive.png"
+	}
+
+	// the browser stretches the image to the size set by MediaSize, which
+	// smooths it out the same as rendering it at full size
+	width, height := fitSize(attachment.Width, attachment.Height, 32)
+
+	if width == 0 || height == 0 {
+		width, height = 32, 32
+	}
+
+	img, err := util.BlurhashDecode(attachment.Blurhash, width, height)
+
+	if err != nil {
+		return "/static/sensitive.png"
+	}
+
+	var buf bytes.Buffer
+
+	if err := png.Encode(&buf, img); err != nil {
+		return "/static/sensitive.png"
+	}
+
+	return template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()))
+}
+
+func fitSize(width int, height int, max int) (int, int) {
+	if width <= 0 || height <= 0 {
+		return 0, 0
+	}
+
+	if width <= max && height <= max {
+		return width, height
+	}
+
+	if width > height {
+		return max, (height*max + width - 1) / width
+	}
+
+	return (width*max + height - 1) / height, max
+}
+
+func gifFrames(f multipart.File) ([]image.Image, error) {
+	var frames []image.Image
+
+	// the decoder keeps every frame, check what it will hold first
+	width, height, count, pixels, err := gifSize(f)
+
+	if err != nil {
+		return frames, err
+	}
+
+	if int64(width)*int64(height) > maxGifPixels || count > maxGifFrames || pixels > maxGifTotalPixels {
+		return frames, errImageTooLarge
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return frames, err
+	}
+
+	g, err := gif.DecodeAll(f)
+
+	if err != nil {
+		return frames, err
+	}
+
+	if len(g.Image) == 0 {
+		return frames, nil
+	}
+
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+
+	if bounds.Empty() {
+		bounds = g.Image[0].Bounds()
+	}
+
+	step := 1
+	if config.PhashFrames > 0 && len(g.Image) > config.PhashFrames {
+		step = len(g.Image) / config.PhashFrames
+	}
+
+	// frames only store what changed, so draw them over a canvas to get the
+	// image that is actually shown
+	canvas := image.NewRGBA(bounds)
+
+	for i, frame := range g.Image {
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+
+		// the hashes are taken from 64x64 images, a small copy is plenty
+		if i%step == 0 && len(frames) < config.PhashFrames {
+			frames = append(frames, resize.Thumbnail(256, 256, canvas, resize.Bilinear))
+		}
+
+		if i < len(g.Disposal) && g.Disposal[i] == gif.DisposalBackground {
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		}
+	}
+
+	return frames, nil
+}
+
+// limits of the gifs decoded, the canvas frames are drawn on takes four bytes
+// for each pixel and each frame one
+const (
+	maxGifPixels      = 4096 * 4096
+	maxGifFrames      = 1000
+	maxGifTotalPixels = 1 << 27
+)
+
+// gifSize returns the size, number of frames and total pixels of the frames of
+// the gif r by reading its blocks without decoding them.
+func gifSize(r io.Reader) (int, int, int, int64, error) {
+	var count int
+	var pixels int64
+
+	b := bufio.NewReader(r)
+	header := make([]byte, 13)
+
+	if _, err := io.ReadFull(b, header); err != nil {
+		return 0, 0, 0, 0, err
+	}
+
+	if string(header[:3]) != "GIF" {
+		return 0, 0, 0, 0, errors.New("not a gif")
+	}
+
+	width := int(binary.LittleEndian.Uint16(header[6:8]))
+	height := int(binary.LittleEndian.Uint16(header[8:10]))
+
+	if header[10]&0x80 != 0 {
+		if _, err := b.Discard(3 << (header[10]&0x07 + 1)); err != nil {
+			return 0, 0, 0, 0, err
+		}
+	}
+
+	for {
+		block, err := b.ReadByte()
+
+		if err != nil {
+			return 0, 0, 0, 0, err
+		}
+
+		switch block {
+		case 0x21:
+			// extension label then data
+			if _, err := b.ReadByte(); err != nil {
+				return 0, 0, 0, 0, err
+			}
+		case 0x2C:
+			desc := make([]byte, 9)
+
+			if _, err := io.ReadFull(b, desc); err != nil {
+				return 0, 0, 0, 0, err
+			}
+
+			count++
+			pixels += int64(binary.LittleEndian.Uint16(desc[4:6])) * int64(binary.LittleEndian.Uint16(desc[6:8]))
+
+			if desc[8]&0x80 != 0 {
+				if _, err := b.Discard(3 << (desc[8]&0x07 + 1)); err != nil {
+					return 0, 0, 0, 0, err
+				}
+			}
+
+			// LZW minimum code size
+			if _, err := b.ReadByte(); err != nil {
+				return 0, 0, 0, 0, err
+			}
+		case 0x3B:
+			return width, height, count, pixels, nil
+		default:
+			return 0, 0, 0, 0, errors.New("invalid gif block")
+		}
+
+		// skip the data sub-blocks
+		for {
+			size, err := b.ReadByte()
+
+			if err != nil {
+				return 0, 0, 0, 0, err
+			}
+
+			if size == 0 {
+				break
+			}
+
+			if _, err := b.Discard(int(size)); err != nil {
+				return 0, 0, 0, 0, err
+			}
+		}
+
+		if count > maxGifFrames || pixels > maxGifTotalPixels {
+			return width, height, count, pixels, nil
+		}
+	}
+}
+
+func videoFrames(f multipart.File) ([]image.Image, error) {
+	var frames []image.Image
+
+	dir, err := os.MkdirTemp("", "fchan-frames")
+
+	if err != nil {
+		return frames, err
+	}
+
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "media")
+	out, err := os.Create(src)
+
+	if err != nil {
+		return frames, err
+	}
+
+	f.Seek(0, 0)
+	_, err = io.Copy(out, f)
+	out.Close()
+
+	if err != nil {
+		return frames, err
+	}
+
+	cmd := exec.Command("ffmpeg", "-loglevel", "error", "-skip_frame", "nokey", "-i", src, "-vsync", "vfr", "-frames:v", strconv.Itoa(config.PhashFrames), filepath.Join(dir, "frame%03d.png"))
+
+	if err := cmd.Run(); err != nil {
+		return frames, err
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "frame*.png"))
+
+	if err != nil {
+		return frames, err
+	}
+
+	sort.Strings(files)
+
+	for _, file := range files {
+		fr, err := os.Open(file)
+
+		if err != nil {
+			continue
+		}
+
+		img, err := decodeImage(fr)
+		fr.Close()
+
+		if err != nil {
+			continue
+		}
+
+		frames = append(frames, img)
+	}
+
+	return frames, nil
+}
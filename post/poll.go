@@ -0,0 +1,73 @@
+package post
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FChannel0/FChannel-Server/activitypub"
+	"github.com/FChannel0/FChannel-Server/config"
+	"github.com/FChannel0/FChannel-Server/util"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Polls are made from the poll field of the post form, one choice a line.
+
+const maxPollChoices = 10
+const maxPollChoiceLength = 100
+
+// poll expiry in hours when none or an invalid one is given
+const defaultPollExpiry = 24
+const maxPollExpiry = 24 * 7
+
+// ParsePoll adds the poll of the post form to obj if it has at least two
+// choices.
+func ParsePoll(ctx *fiber.Ctx, obj activitypub.ObjectBase) activitypub.ObjectBase {
+	var choices []activitypub.ObjectBase
+	var names []string
+
+	for _, e := range strings.Split(ctx.FormValue("poll"), "\n") {
+		name := util.EscapeString(strings.TrimSpace(e))
+
+		if name == "" || len(name) > maxPollChoiceLength || util.IsInStringArray(names, name) {
+			continue
+		}
+
+		if len(choices) >= maxPollChoices {
+			break
+		}
+
+		choices = append(choices, activitypub.ObjectBase{Type: "Note", Name: name})
+		names = append(names, name)
+	}
+
+	if len(choices) < 2 {
+		return obj
+	}
+
+	hours, err := strconv.Atoi(ctx.FormValue("pollexpiry"))
+	if err != nil || hours < 1 || hours > maxPollExpiry {
+		hours = defaultPollExpiry
+	}
+
+	obj.EndTime = time.Now().UTC().Add(time.Duration(hours) * time.Hour).Format(time.RFC3339)
+
+	if ctx.FormValue("pollmultiple") != "" {
+		obj.AnyOf = choices
+	} else {
+		obj.OneOf = choices
+	}
+
+	return obj
+}
+
+// VoterHash returns what a vote from ip in the poll id is stored as, so votes
+// can be limited to one per IP without keeping the IP.
+func VoterHash(ip string, id string) string {
+	hasher := sha256.New()
+	hasher.Write([]byte(config.Salt + ip + id))
+
+	return base64.URLEncoding.EncodeToString(hasher.Sum(nil))
+}
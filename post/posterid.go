@@ -0,0 +1,27 @@
+package post
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+
+	"github.com/FChannel0/FChannel-Server/config"
+	"github.com/FChannel0/FChannel-Server/util"
+)
+
+// HiddenPosterID is shown for posters whose IP is shared by everyone using
+// it, such as Tor exits.
+const HiddenPosterID = "HiddenID"
+
+// CreatePosterID returns the ID shown for posts made from ip in thread. It is
+// salted with the instance salt so IDs can not be matched to IPs.
+func CreatePosterID(ip string, thread string) string {
+	if ip == "" || ip == "172.16.0.1" || util.IsTorExit(ip) {
+		return HiddenPosterID
+	}
+
+	hasher := sha256.New()
+	hasher.Write([]byte(config.Salt + ip + thread))
+	sha := base64.URLEncoding.EncodeToString(hasher.Sum(nil))
+
+	return sha[:8]
+}
@@ -0,0 +1,115 @@
+package post
+
+import (
+	"crypto/rand"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/FChannel0/FChannel-Server/activitypub"
+	"github.com/FChannel0/FChannel-Server/util"
+)
+
+// Dice and fortunes are rolled when the post is made and stored as tags of
+// the post, so they can not be changed and are sent to other instances.
+
+var diceRe = regexp.MustCompile(`^dice ?([0-9]{1,2})d([0-9]{1,4})([+-][0-9]{1,4})?$`)
+
+var fortunes = []string{
+	"Reply hazy, try again",
+	"Excellent Luck",
+	"Good Luck",
+	"Average Luck",
+	"Bad Luck",
+	"Good news will come to you by mail",
+	"You will meet a dark handsome stranger",
+	"Better not tell you now",
+	"Outlook good",
+	"Very Bad Luck",
+	"Godly Luck",
+}
+
+// IsRollOption returns true if option asks for dice or a fortune.
+func IsRollOption(option string) bool {
+	return option == "fortune" || diceRe.MatchString(option)
+}
+
+// RollOptions returns the tags for the dice and fortune in options, at most
+// one of each.
+func RollOptions(options []string) ([]activitypub.ObjectBase, error) {
+	var tags []activitypub.ObjectBase
+	var dice, fortune bool
+
+	for _, e := range options {
+		if e == "fortune" && !fortune {
+			n, err := randomInt(len(fortunes))
+
+			if err != nil {
+				return tags, util.MakeError(err, "RollOptions")
+			}
+
+			tags = append(tags, activitypub.ObjectBase{Type: activitypub.FortuneType, Name: "fortune", Content: fortunes[n]})
+			fortune = true
+		} else if match := diceRe.FindStringSubmatch(e); match != nil && !dice {
+			count, _ := strconv.Atoi(match[1])
+			sides, _ := strconv.Atoi(match[2])
+			modifier, _ := strconv.Atoi(match[3])
+
+			if count < 1 || sides < 1 {
+				continue
+			}
+
+			result, err := RollDice(count, sides, modifier)
+
+			if err != nil {
+				return tags, util.MakeError(err, "RollOptions")
+			}
+
+			tags = append(tags, activitypub.ObjectBase{Type: activitypub.DiceType, Name: strings.TrimPrefix(strings.TrimPrefix(e, "dice"), " "), Content: result})
+			dice = true
+		}
+	}
+
+	return tags, nil
+}
+
+// RollDice rolls count dice with sides sides and returns the result written
+// out, such as "3, 5 + 1 = 9".
+func RollDice(count int, sides int, modifier int) (string, error) {
+	var rolls []string
+	var total int
+
+	for i := 0; i < count; i++ {
+		n, err := randomInt(sides)
+
+		if err != nil {
+			return "", util.MakeError(err, "RollDice")
+		}
+
+		rolls = append(rolls, strconv.Itoa(n+1))
+		total += n + 1
+	}
+
+	result := strings.Join(rolls, ", ")
+
+	if modifier > 0 {
+		result += " + " + strconv.Itoa(modifier)
+	} else if modifier < 0 {
+		result += " - " + strconv.Itoa(-modifier)
+	}
+
+	total += modifier
+
+	return result + " = " + strconv.Itoa(total), nil
+}
+
+func randomInt(max int) (int, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(max)))
+
+	if err != nil {
+		return 0, err
+	}
+
+	return int(n.Int64()), nil
+}
@@ -0,0 +1,184 @@
+package post
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/FChannel0/FChannel-Server/activitypub"
+	"github.com/FChannel0/FChannel-Server/config"
+	"github.com/FChannel0/FChannel-Server/db"
+	"github.com/FChannel0/FChannel-Server/util"
+)
+
+// Posts are scored by each of SpamFilters and the total decides, with the
+// thresholds of the board, whether a post is allowed, held for review or
+// rejected. Local and federated posts go through the same filters, the ones
+// needing the IP of the poster only score local posts.
+
+// SpamPost is a post as the spam filters see it.
+type SpamPost struct {
+	Actor  activitypub.Actor
+	Object activitypub.ObjectBase
+	// originality hashes of the text and files of the post
+	Hashes []string
+	// IP of the poster, empty for federated posts
+	IP string
+}
+
+// A SpamFilter adds to the spam score of a post, with the reasons for it.
+type SpamFilter interface {
+	Score(post SpamPost) (int, []string, error)
+}
+
+var SpamFilters = []SpamFilter{
+	LinkFilter{},
+	RepeatFilter{},
+	BurstFilter{},
+	TorFilter{},
+	MediaFilter{},
+}
+
+// CheckSpam runs post through SpamFilters and returns the verdict of the
+// board for its score with the reasons.
+func CheckSpam(post SpamPost) (string, []string, error) {
+	var score int
+	var reasons []string
+
+	for _, e := range SpamFilters {
+		s, r, err := e.Score(post)
+
+		if err != nil {
+			return activitypub.SpamAllow, reasons, util.MakeError(err, "CheckSpam")
+		}
+
+		score += s
+		reasons = append(reasons, r...)
+	}
+
+	verdict, err := post.Actor.SpamVerdict(score)
+
+	if verdict != activitypub.SpamAllow {
+		config.Log.Printf("spam %s for %s (score %d): %s", verdict, post.Object.Id, score, strings.Join(reasons, ", "))
+	}
+
+	return verdict, reasons, util.MakeError(err, "CheckSpam")
+}
+
+// CheckFederatedSpam is the activitypub.SpamCheck for posts from other
+// instances.
+func CheckFederatedSpam(actor activitypub.Actor, obj activitypub.ObjectBase) (string, []string, error) {
+	return CheckSpam(SpamPost{Actor: actor, Object: obj, Hashes: obj.OriginalityHashes()})
+}
+
+var spamLinkRe = regexp.MustCompile(`https?://`)
+
+// LinkFilter scores posts made mostly of links.
+type LinkFilter struct{}
+
+func (LinkFilter) Score(post SpamPost) (int, []string, error) {
+	links := len(spamLinkRe.FindAllString(post.Object.Content, -1))
+	words := len(strings.Fields(post.Object.Content))
+
+	if links == 0 || (links < 3 && links*3 < words) {
+		return 0, nil, nil
+	}
+
+	score := 15 * links
+	if score > 60 {
+		score = 60
+	}
+
+	return score, []string{strconv.Itoa(links) + " links"}, nil
+}
+
+// RepeatFilter scores posts whose text was posted on other boards in the
+// last hour.
+type RepeatFilter struct{}
+
+func (RepeatFilter) Score(post SpamPost) (int, []string, error) {
+	var boards int
+
+	for _, e := range post.Hashes {
+		if !strings.HasPrefix(e, "text:") {
+			continue
+		}
+
+		query := `select count(distinct actor) from originality where hash=$1 and actor!=$2 and published > NOW() - interval '1 hour'`
+		if err := config.DB.QueryRow(query, e, post.Actor.Id).Scan(&boards); err != nil {
+			return 0, nil, util.MakeError(err, "RepeatFilter")
+		}
+	}
+
+	if boards == 0 {
+		return 0, nil, nil
+	}
+
+	return 30 * boards, []string{"posted on " + strconv.Itoa(boards) + " other boards"}, nil
+}
+
+// BurstFilter scores bursts of posts from IPs that did not post before the
+// last day.
+type BurstFilter struct{}
+
+func (BurstFilter) Score(post SpamPost) (int, []string, error) {
+	var recent, old int
+
+	if post.IP == "" {
+		return 0, nil, nil
+	}
+
+	query := `select count(*) filter (where posted > timezone('utc', now()) - interval '10 minutes'), count(*) filter (where posted < timezone('utc', now()) - interval '1 day') from identify where ip=$1::inet`
+	if err := config.DB.QueryRow(query, post.IP).Scan(&recent, &old); err != nil {
+		return 0, nil, util.MakeError(err, "BurstFilter")
+	}
+
+	if old > 0 || recent < 3 {
+		return 0, nil, nil
+	}
+
+	return 15 * recent, []string{strconv.Itoa(recent) + " posts in 10 minutes from a new IP"}, nil
+}
+
+// TorFilter scores posts from Tor exits.
+type TorFilter struct{}
+
+func (TorFilter) Score(post SpamPost) (int, []string, error) {
+	if post.IP == "" || !util.IsTorExit(post.IP) {
+		return 0, nil, nil
+	}
+
+	return 30, []string{"Tor exit"}, nil
+}
+
+// MediaFilter scores posts with files whose content hash was banned. Files are
+// named after their hash so this works for federated posts too.
+type MediaFilter struct{}
+
+func (MediaFilter) Score(post SpamPost) (int, []string, error) {
+	var hashes []string
+
+	for _, e := range post.Hashes {
+		if strings.HasPrefix(e, "media:") {
+			hashes = append(hashes, strings.TrimPrefix(e, "media:"))
+		}
+	}
+
+	for _, e := range post.Object.Attachment {
+		if e.Href != "" {
+			hashes = append(hashes, activitypub.MediaHash(e.Href))
+		}
+	}
+
+	banned, err := db.IsFileHashBanned(hashes)
+
+	if err != nil {
+		return 0, nil, util.MakeError(err, "MediaFilter")
+	}
+
+	if !banned {
+		return 0, nil, nil
+	}
+
+	return 100, []string{"banned media"}, nil
+}
@@ -54,7 +54,7 @@ func CreateNameTripCode(ctx *fiber.Ctx) (string, string, error) {
 		janitor := cejanitor.MatchString(chunck)
 		board, modcred := util.GetPasswordFromSession(ctx)
 
-		if hasAuth, _ := util.HasAuth(modcred, board); hasAuth {
+		if hasAuth, level := util.HasAuth(modcred, board); hasAuth {
 			if chunck == "" { // If no capcode specified then use modcred as level
 				modlevel := strings.Title(util.GetModLevel(board, modcred))
 				if modlevel == "Admin" {
@@ -62,11 +62,11 @@ func CreateNameTripCode(ctx *fiber.Ctx) (string, string, error) {
 				}
 				return tripSecure.ReplaceAllString(input, ""), "#" + modlevel, nil
 			}
-			if admin {
+			if admin && CapcodeAllowed("#Admin", level) {
 				return tripSecure.ReplaceAllString(input, ""), "#Admin", nil
-			} else if mod {
+			} else if mod && CapcodeAllowed("#Mod", level) {
 				return tripSecure.ReplaceAllString(input, ""), "#Mod", nil
-			} else if janitor {
+			} else if janitor && CapcodeAllowed("#Janitor", level) {
 				return tripSecure.ReplaceAllString(input, ""), "#Janitor", nil
 			}
 		}
@@ -89,12 +89,12 @@ func CreateNameTripCode(ctx *fiber.Ctx) (string, string, error) {
 		janitor := cejanitor.MatchString(chunck)
 		board, modcred := util.GetPasswordFromSession(ctx)
 
-		if hasAuth, _ := util.HasAuth(modcred, board); hasAuth {
-			if admin {
+		if hasAuth, level := util.HasAuth(modcred, board); hasAuth {
+			if admin && CapcodeAllowed("#Admin", level) {
 				return trip.ReplaceAllString(input, ""), "#Admin", nil
-			} else if mod {
+			} else if mod && CapcodeAllowed("#Mod", level) {
 				return trip.ReplaceAllString(input, ""), "#Mod", nil
-			} else if janitor {
+			} else if janitor && CapcodeAllowed("#Janitor", level) {
 				return trip.ReplaceAllString(input, ""), "#Janitor", nil
 			}
 		}
@@ -106,6 +106,34 @@ func CreateNameTripCode(ctx *fiber.Ctx) (string, string, error) {
 	return input, "", nil
 }
 
+// capcodes and the boardaccess types allowed to use them, staff can post
+// with the capcode of their own type or a lower one
+var capcodeRanks = map[string]int{
+	"#Janitor": 1,
+	"#Mod":     2,
+	"#Admin":   3,
+}
+
+var levelRanks = map[string]int{
+	"janitor": 1,
+	"custom":  1,
+	"mod":     2,
+	"admin":   3,
+}
+
+// IsCapcode returns true if tripcode is a staff capcode.
+func IsCapcode(tripcode string) bool {
+	_, ok := capcodeRanks[tripcode]
+	return ok
+}
+
+// CapcodeAllowed returns true if staff with the boardaccess type level can
+// post with capcode.
+func CapcodeAllowed(capcode string, level string) bool {
+	rank, ok := capcodeRanks[capcode]
+	return ok && rank <= levelRanks[strings.ToLower(level)]
+}
+
 func TripCode(pass string) string {
 	var salt [2]rune
 
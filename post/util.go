@@ -1,13 +1,9 @@
 package post
 
 import (
-	"database/sql"
 	"fmt"
+	"html"
 	"html/template"
-	"image"
-	_ "image/gif"
-	_ "image/jpeg"
-	_ "image/png"
 	"io/ioutil"
 	"mime/multipart"
 	"os"
@@ -19,13 +15,19 @@ import (
 	"github.com/FChannel0/FChannel-Server/activitypub"
 	"github.com/FChannel0/FChannel-Server/config"
 	"github.com/FChannel0/FChannel-Server/db"
+	"github.com/FChannel0/FChannel-Server/storage"
 	"github.com/FChannel0/FChannel-Server/util"
+	"github.com/FChannel0/FChannel-Server/webfinger"
 	"github.com/gofiber/fiber/v2"
 
 	"github.com/corona10/goimagehash"
 	"github.com/sourcegraph/syntaxhighlight"
 )
 
+// referenceWait is how long posting waits for quoted remote posts that are
+// not stored to be fetched.
+const referenceWait = 3 * time.Second
+
 func ConvertHashLink(domain string, link string) string {
 	re := regexp.MustCompile(`(#.+)`)
 	parsedLink := re.FindString(link)
@@ -40,14 +42,15 @@ func ConvertHashLink(domain string, link string) string {
 	return parsedLink
 }
 
-func ParseCommentForReplies(comment string, op string) ([]activitypub.ObjectBase, error) {
-	re := regexp.MustCompile(`(>>(https?://[A-Za-z0-9_.:\-~]+\/[A-Za-z0-9_.\-~]+\/)(f[A-Za-z0-9_.\-~]+-)?([A-Za-z0-9_.\-~]+)?#?([A-Za-z0-9_.\-~]+)?)`)
-	match := re.FindAllStringSubmatch(comment, -1)
+// ContentQuotes is the activitypub.ParseQuotes for the markup of content.
+func ContentQuotes(content string) []string {
+	return MarkupQuotes(ParseMarkup(content))
+}
 
+func ParseCommentForReplies(comment string, op string) ([]activitypub.ObjectBase, error) {
 	var links []string
 
-	for i := 0; i < len(match); i++ {
-		str := strings.Replace(match[i][0], ">>", "", 1)
+	for _, str := range MarkupQuotes(ParseMarkup(comment)) {
 		str = strings.Replace(str, "www.", "", 1)
 		str = strings.Replace(str, "http://", "", 1)
 		str = strings.Replace(str, "https://", "", 1)
@@ -63,16 +66,11 @@ func ParseCommentForReplies(comment string, op string) ([]activitypub.ObjectBase
 		}
 	}
 
+	valid := activitypub.ResolveReferences(links, referenceWait)
+
 	var validLinks []activitypub.ObjectBase
 	for i := 0; i < len(links); i++ {
-		reqActivity := activitypub.Activity{Id: links[i]}
-		_, isValid, err := reqActivity.CheckValid()
-
-		if err != nil {
-			return nil, util.MakeError(err, "ParseCommentForReplies")
-		}
-
-		if isValid {
+		if valid[links[i]] {
 			var reply activitypub.ObjectBase
 
 			reply.Id = links[i]
@@ -85,25 +83,10 @@ func ParseCommentForReplies(comment string, op string) ([]activitypub.ObjectBase
 }
 
 func ParseCommentForReply(comment string) (string, error) {
-	re := regexp.MustCompile(`(>>(https?://[A-Za-z0-9_.:\-~]+\/[A-Za-z0-9_.\-~]+\/)(f[A-Za-z0-9_.\-~]+-)?([A-Za-z0-9_.\-~]+)?#?([A-Za-z0-9_.\-~]+)?)`)
-	match := re.FindAllStringSubmatch(comment, -1)
-
-	var links []string
-
-	for i := 0; i < len(match); i++ {
-		str := strings.Replace(match[i][0], ">>", "", 1)
-		links = append(links, str)
-	}
+	links := MarkupQuotes(ParseMarkup(comment))
 
 	if len(links) > 0 {
-		reqActivity := activitypub.Activity{Id: strings.ReplaceAll(links[0], ">", "")}
-		_, isValid, err := reqActivity.CheckValid()
-
-		if err != nil {
-			return "", util.MakeError(err, "ParseCommentForReply")
-		}
-
-		if isValid {
+		if valid := activitypub.ResolveReferences(links[:1], referenceWait); valid[links[0]] {
 			return links[0], nil
 		}
 	}
@@ -111,29 +94,30 @@ func ParseCommentForReply(comment string) (string, error) {
 	return "", nil
 }
 
+// ParseLinkTitle returns content as plain text with quotes shortened, for
+// the title shown when hovering a quote.
 func ParseLinkTitle(actorName string, op string, content string) string {
-	re := regexp.MustCompile(`(>>(https?://[A-Za-z0-9_.:\-~]+\/[A-Za-z0-9_.\-~]+\/)\w+(#.+)?)`)
-	match := re.FindAllStringSubmatch(content, -1)
+	return RenderText(ParseMarkup(content), func(node *Node) string {
+		if node.Type == BoardLinkNode {
+			return ">>>" + node.Text
+		}
 
-	for i, _ := range match {
-		link := strings.Replace(match[i][0], ">>", "", 1)
-		isOP := ""
+		link := node.Text
 
-		domain := match[i][2]
+		var domain string
 
-		if link == op {
-			isOP = " (OP)"
+		if match := quoteLinkRe.FindStringSubmatch(">>" + link); match != nil {
+			domain = match[1]
 		}
 
-		link = ConvertHashLink(domain, link)
-		content = strings.Replace(content, match[i][0], ">>"+util.ShortURL(actorName, link)+isOP, 1)
-	}
+		isOP := ""
 
-	content = strings.ReplaceAll(content, "'", "&#39;")
-	content = strings.ReplaceAll(content, "\"", "&quot;")
-	content = strings.ReplaceAll(content, ">", `/\&lt;`)
+		if link == op {
+			isOP = " (OP)"
+		}
 
-	return content
+		return ">>" + util.ShortURL(actorName, ConvertHashLink(domain, link)) + isOP
+	})
 }
 
 func ParseOptions(ctx *fiber.Ctx, obj activitypub.ObjectBase) activitypub.ObjectBase {
@@ -164,6 +148,8 @@ func ParseOptions(ctx *fiber.Ctx, obj activitypub.ObjectBase) activitypub.Object
 				obj.Wallet = append(obj.Wallet, wallet)
 			} else if delete.MatchString(e) {
 				obj.Option = append(obj.Option, e)
+			} else if IsRollOption(e) {
+				obj.Option = append(obj.Option, e)
 			}
 		}
 	}
@@ -213,31 +199,21 @@ func GetCaptchaCode(captcha string) string {
 
 func IsMediaBanned(f multipart.File) (bool, error) {
 	//TODO: Decoders for JPEG-XL and AVIF
-	//TODO: fall back to old hashing if any errors
-	mimetype, _ := util.GetFileContentType(f)
-	switch mimetype {
-	case "image/jpeg", "image/png", "image/gif":
-		image, _, _ := image.Decode(f)
-		imagehash, _ := goimagehash.PerceptionHash(image)
-		var rows *sql.Rows
-		query := `select phash from bannedimages`
-		rows, err := config.DB.Query(query)
-		if err != nil && rows == nil {
-			break
-		}
-		if rows != nil {
-			defer rows.Close()
-			for rows.Next() {
-				var phash uint64
-				err := rows.Scan(&phash)
-				if err != nil {
-					break
-				}
+	if frames, _ := MediaFrames(f); len(frames) > 0 {
+		banned, err := db.GetBannedPhashes()
+
+		if err != nil {
+			return true, util.MakeError(err, "IsMediaBanned")
+		}
+
+		for _, hash := range MediaHashes(frames) {
+			imagehash := goimagehash.NewImageHash(hash, goimagehash.PHash)
 
-				current := goimagehash.NewImageHash(phash, 2)
+			for _, phash := range banned {
+				current := goimagehash.NewImageHash(phash, goimagehash.PHash)
 				distance, _ := current.Distance(imagehash)
-				if distance == 0 {
-					config.Log.Printf("phash (%d) similar to banned hash (%d)", imagehash.GetHash(), current.GetHash())
+				if distance <= config.PhashDistance {
+					config.Log.Printf("phash (%d) similar to banned hash (%d) distance %d", imagehash.GetHash(), current.GetHash(), distance)
 					return true, nil
 				}
 			}
@@ -258,6 +234,66 @@ func IsMediaBanned(f multipart.File) (bool, error) {
 	return db.IsHashBanned(hash)
 }
 
+// BanMedia bans the file at href, by its perceptual hashes if it has frames
+// and by its file hash otherwise.
+func BanMedia(href string, note string) error {
+	f, err := storage.Open(href)
+
+	if err != nil {
+		return util.MakeError(err, "BanMedia")
+	}
+
+	defer f.Close()
+
+	if frames, _ := MediaFrames(f); len(frames) > 0 {
+		hashes := MediaHashes(frames)
+		thumbnail, _ := MediaThumbnail(frames[0])
+
+		config.Log.Println("Banning hashes: ", hashes)
+
+		return util.MakeError(db.BanImageHashes(hashes, activitypub.MediaHash(href), note, thumbnail), "BanMedia")
+	}
+
+	bytes := make([]byte, 2048)
+
+	if _, err = f.Read(bytes); err != nil {
+		return util.MakeError(err, "BanMedia")
+	}
+
+	f.Seek(0, 0)
+
+	if banned, err := IsMediaBanned(f); err == nil && !banned {
+		return util.MakeError(db.BanMediaHash(util.HashBytes(bytes), activitypub.MediaHash(href), note), "BanMedia")
+	}
+
+	return nil
+}
+
+// OriginalityHashes returns the hashes the comment and file of the post form
+// are checked against on R9K boards. The file is only read and hashed if
+// withFile is set, other boards get its hash from the stored attachment.
+func OriginalityHashes(ctx *fiber.Ctx, withFile bool) ([]string, error) {
+	var media []string
+
+	if header, _ := ctx.FormFile("file"); header != nil && withFile {
+		f, err := header.Open()
+		if err != nil {
+			return nil, util.MakeError(err, "OriginalityHashes")
+		}
+
+		defer f.Close()
+
+		fileBytes, err := ioutil.ReadAll(f)
+		if err != nil {
+			return nil, util.MakeError(err, "OriginalityHashes")
+		}
+
+		media = append(media, util.HashBytes(fileBytes))
+	}
+
+	return activitypub.OriginalityHashes(ctx.FormValue("comment"), media), nil
+}
+
 func SupportedMIMEType(mime string) bool {
 	for _, e := range config.SupportedFiles {
 		if e == mime {
@@ -288,23 +324,57 @@ func ObjectFromForm(ctx *fiber.Ctx, obj activitypub.ObjectBase) (activitypub.Obj
 			return obj, util.MakeError(err, "ObjectFromForm")
 		}
 
-		defer tempFile.Close()
+		if tempFile == nil {
+			obj.Preview = obj.Attachment[0].GetMediaPreview()
+			obj.Attachment[0].Url = activitypub.FallbackUrl(obj.Attachment[0].GetMediaFallback())
+			obj.Attachment[0] = obj.Attachment[0].GetMediaInfo()
+		} else {
+			defer os.Remove(tempFile.Name())
+			defer tempFile.Close()
+
+			fileBytes, _ := ioutil.ReadAll(file)
+			tempFile.Write(fileBytes)
 
-		fileBytes, _ := ioutil.ReadAll(file)
-		tempFile.Write(fileBytes)
+			re := regexp.MustCompile(`image/(jpe?g|png|webp)`)
+			if re.MatchString(obj.Attachment[0].MediaType) {
+				cmd := exec.Command("exiv2", "rm", tempFile.Name())
 
-		re := regexp.MustCompile(`image/(jpe?g|png|webp)`)
-		if re.MatchString(obj.Attachment[0].MediaType) {
-			fileLoc := strings.ReplaceAll(obj.Attachment[0].Href, config.Domain, "")
+				if err := cmd.Run(); err != nil {
+					return obj, util.MakeError(err, "ObjectFromForm")
+				}
+			}
 
-			cmd := exec.Command("exiv2", "rm", "."+fileLoc)
+			previewSrc := tempFile.Name()
+
+			if activitypub.NeedsFallback(obj.Attachment[0].MediaType) {
+				if fallbackFile, fallback, err := obj.Attachment[0].CreateFallback(tempFile.Name()); err == nil {
+					defer os.Remove(fallbackFile)
+					previewSrc = fallbackFile
+					obj.Attachment[0].Url = activitypub.FallbackUrl(fallback)
+
+					if err := obj.Attachment[0].SetMediaFallback(fallback); err != nil {
+						return obj, util.MakeError(err, "ObjectFromForm")
+					}
+				} else {
+					config.Log.Println(err)
+				}
+			}
 
-			if err := cmd.Run(); err != nil {
+			obj.Preview = obj.Attachment[0].CreatePreview(previewSrc)
+			obj.Attachment[0].Width, obj.Attachment[0].Height, obj.Attachment[0].Duration, obj.Attachment[0].Blurhash = MediaInfo(previewSrc, obj.Attachment[0].MediaType)
+
+			if err := storage.Store.Put(storage.Name(obj.Attachment[0].Href), tempFile.Name(), obj.Attachment[0].MediaType); err != nil {
 				return obj, util.MakeError(err, "ObjectFromForm")
 			}
-		}
 
-		obj.Preview = obj.Attachment[0].CreatePreview()
+			if err := obj.Attachment[0].SetMediaPreview(obj.Preview.Href); err != nil {
+				return obj, util.MakeError(err, "ObjectFromForm")
+			}
+
+			if err := obj.Attachment[0].SetMediaInfo(); err != nil {
+				return obj, util.MakeError(err, "ObjectFromForm")
+			}
+		}
 	}
 
 	obj.AttributedTo = util.EscapeString(ctx.FormValue("name"))
@@ -312,7 +382,9 @@ func ObjectFromForm(ctx *fiber.Ctx, obj activitypub.ObjectBase) (activitypub.Obj
 	obj.Name = util.EscapeString(ctx.FormValue("subject"))
 	obj.Content = util.EscapeString(ctx.FormValue("comment"))
 	obj.Sensitive = (ctx.FormValue("sensitive") != "")
+	obj.Tag = append(obj.Tag, ResolveBoardLinks(obj.Content)...)
 	obj = ParseOptions(ctx, obj)
+	obj = ParsePoll(ctx, obj)
 
 	var originalPost activitypub.ObjectBase
 
@@ -453,26 +525,51 @@ func ParseAttachment(obj activitypub.ObjectBase, catalog bool) template.HTML {
 	var media string
 
 	if regexp.MustCompile(`image\/`).MatchString(obj.Attachment[0].MediaType) {
-		media = "<img "
+		// browsers pick the original from the source once enlarged if they can
+		// display it, otherwise the img falls back to the converted copy
+		// only the formats converted on upload get a source, the type of
+		// remote attachments is whatever the other instance sent
+		var fallback string
+		if activitypub.NeedsFallback(obj.Attachment[0].MediaType) {
+			fallback = obj.Attachment[0].GetFallback()
+		}
+
+		if fallback != "" {
+			media = "<picture>"
+			media += "<source "
+			media += "type=\"" + html.EscapeString(obj.Attachment[0].MediaType) + "\" "
+			media += "original=\"" + html.EscapeString(util.MediaProxy(obj.Attachment[0].Href)) + "\" "
+			media += ">"
+		}
+
+		media += "<img "
 		media += "id=\"img\" "
 		media += "main=\"1\" "
 		media += "enlarge=\"0\" "
-		media += "attachment=\"" + obj.Attachment[0].Href + "\" "
+		if fallback != "" {
+			media += "attachment=\"" + html.EscapeString(util.MediaProxy(fallback)) + "\" "
+		} else {
+			media += "attachment=\"" + html.EscapeString(obj.Attachment[0].Href) + "\" "
+		}
 		if catalog {
-			media += "style=\"max-width: 180px; max-height: 180px;\" "
+			media += "style=\"" + MediaSize(obj.Attachment[0], 180) + "max-width: 180px; max-height: 180px;\" "
 		} else {
-			media += "style=\"float: left; margin-right: 10px; margin-bottom: 10px; max-width: 250px; max-height: 250px;\" "
+			media += "style=\"" + MediaSize(obj.Attachment[0], 250) + "float: left; margin-right: 10px; margin-bottom: 10px; max-width: 250px; max-height: 250px;\" "
 		}
 		if obj.Preview.Id != "" {
-			media += "src=\"" + util.MediaProxy(obj.Preview.Href) + "\" "
-			media += "preview=\"" + util.MediaProxy(obj.Preview.Href) + "\" "
+			media += "src=\"" + html.EscapeString(util.MediaProxy(obj.Preview.Href)) + "\" "
+			media += "preview=\"" + html.EscapeString(util.MediaProxy(obj.Preview.Href)) + "\" "
 		} else {
-			media += "src=\"" + util.MediaProxy(obj.Attachment[0].Href) + "\" "
-			media += "preview=\"" + util.MediaProxy(obj.Attachment[0].Href) + "\" "
+			media += "src=\"" + html.EscapeString(util.MediaProxy(obj.Attachment[0].Href)) + "\" "
+			media += "preview=\"" + html.EscapeString(util.MediaProxy(obj.Attachment[0].Href)) + "\" "
 		}
 
 		media += ">"
 
+		if fallback != "" {
+			media += "</picture>"
+		}
+
 		return template.HTML(media)
 	}
 
@@ -487,8 +584,8 @@ func ParseAttachment(obj activitypub.ObjectBase, catalog bool) template.HTML {
 		}
 		media += ">"
 		media += "<source "
-		media += "src=\"" + util.MediaProxy(obj.Attachment[0].Href) + "\" "
-		media += "type=\"" + obj.Attachment[0].MediaType + "\" "
+		media += "src=\"" + html.EscapeString(util.MediaProxy(obj.Attachment[0].Href)) + "\" "
+		media += "type=\"" + html.EscapeString(obj.Attachment[0].MediaType) + "\" "
 		media += ">"
 		media += "Audio is not supported."
 		media += "</audio>"
@@ -502,14 +599,14 @@ func ParseAttachment(obj activitypub.ObjectBase, catalog bool) template.HTML {
 		media += "preload=\"metadata\" "
 		//media += "muted=\"muted\" "
 		if catalog {
-			media += "style=\"margin-right: 10px; margin-bottom: 10px; max-width: 180px; max-height: 180px;\" "
+			media += "style=\"" + MediaSize(obj.Attachment[0], 180) + "margin-right: 10px; margin-bottom: 10px; max-width: 180px; max-height: 180px;\" "
 		} else {
-			media += "style=\"float: left; margin-right: 10px; margin-bottom: 10px; max-width: 250px; max-height: 250px;\" "
+			media += "style=\"" + MediaSize(obj.Attachment[0], 250) + "float: left; margin-right: 10px; margin-bottom: 10px; max-width: 250px; max-height: 250px;\" "
 		}
 		media += ">"
 		media += "<source "
-		media += "src=\"" + util.MediaProxy(obj.Attachment[0].Href) + "\" "
-		media += "type=\"" + obj.Attachment[0].MediaType + "\" "
+		media += "src=\"" + html.EscapeString(util.MediaProxy(obj.Attachment[0].Href)) + "\" "
+		media += "type=\"" + html.EscapeString(obj.Attachment[0].MediaType) + "\" "
 		media += ">"
 		media += "Video is not supported."
 		media += "</video>"
@@ -531,162 +628,296 @@ func ParseAttachment(obj activitypub.ObjectBase, catalog bool) template.HTML {
 	return template.HTML(media)
 }
 
-func ParseContent(board activitypub.Actor, op string, content string, thread activitypub.ObjectBase, id string, _type string) (template.HTML, error) {
-	// TODO: should escape more than just < and >, should also escape &, ", and '
-	nContent := strings.ReplaceAll(content, `<`, "&lt;")
+func ParseContent(board activitypub.Actor, op string, obj activitypub.ObjectBase, thread activitypub.ObjectBase, _type string) (template.HTML, error) {
+	var err error
+
+	nodes := ParseMarkup(obj.Content)
+	truncated := false
 
 	if _type == "new" {
-		nContent = ParseTruncate(nContent, board, op, id)
+		nodes, truncated = TruncateMarkup(nodes, 30)
 	}
 
-	nContent, err := ParseLinkComments(board, op, nContent, thread)
+	nContent := RenderHTML(nodes, func(node *Node) string {
+		if node.Type == BoardLinkNode {
+			return ParseBoardLink(node.Text, obj.Tag)
+		}
+
+		quote, qerr := ParseQuoteLink(board, op, node.Text, thread)
+
+		if qerr != nil && err == nil {
+			err = qerr
+		}
+
+		return quote
+	})
 
 	if err != nil {
 		return "", util.MakeError(err, "ParseContent")
 	}
 
-	nContent = ParseCommentQuotes(nContent)
-	nContent = ParseCommentSpoilers(nContent)
-	//TODO: Don't tuncate code blocks
-	nContent = ParseCommentCode(nContent)
-	nContent = CloseUnclosedTags(nContent)
-	nContent = strings.ReplaceAll(nContent, `/\&lt;`, ">")
+	if truncated {
+		nContent += fmt.Sprintf("<br><a href=\"%s\">(view full post...)</a>", board.Id+"/"+util.ShortURL(board.Outbox, op)+"#"+util.ShortURL(board.Outbox, obj.Id))
+	}
+
 	return template.HTML(nContent), nil
 }
 
-func FormatContent(content string) template.HTML {
-	nContent := strings.ReplaceAll(content, `<`, "&lt;")
-	nContent = ParseCommentQuotes(nContent)
-	nContent = ParseCommentSpoilers(nContent)
-	//TODO: Don't tuncate code blocks
-	nContent = ParseCommentCode(nContent)
-	nContent = CloseUnclosedTags(nContent)
-	return template.HTML(nContent)
+// FormatContent renders the content of obj without looking up the posts it
+// quotes, for the catalog, overboard and feeds.
+func FormatContent(obj activitypub.ObjectBase) template.HTML {
+	return template.HTML(RenderHTML(ParseMarkup(obj.Content), func(node *Node) string {
+		if node.Type == BoardLinkNode {
+			return ParseBoardLink(node.Text, obj.Tag)
+		}
+
+		return DefaultLinkHTML(node)
+	}))
 }
 
-func ParseTruncate(content string, board activitypub.Actor, op string, id string) string {
-	if strings.Count(content, "\r") > 30 {
-		content = strings.ReplaceAll(content, "\r\n", "\r")
-		lines := strings.SplitAfter(content, "\r")
-		content = ""
+var httpRe = regexp.MustCompile(`^https?://`)
+
+// ParseBoardLink returns the html for the board link >>>link using the tag
+// it was resolved to when posted. Links without a tag are left as text.
+func ParseBoardLink(link string, tags []activitypub.ObjectBase) string {
+	for _, e := range tags {
+		if e.Name != ">>>"+link || !httpRe.MatchString(e.Href) {
+			continue
+		}
+
+		href := e.Link
 
-		for i := 0; i < 30; i++ {
-			content += lines[i]
+		// tags stored without a link are linked as sent
+		if !strings.HasPrefix(href, "/") && !httpRe.MatchString(href) {
+			href = e.Href
 		}
 
-		content += fmt.Sprintf("</pre><br><a href=\"%s\">(view full post...)</a>", board.Id+"/"+util.ShortURL(board.Outbox, op)+"#"+util.ShortURL(board.Outbox, id))
+		return "<a class=\"reply\" href=\"" + html.EscapeString(href) + "\">&gt;&gt;&gt;" + html.EscapeString(link) + "</a>"
 	}
 
-	return content
+	return "&gt;&gt;&gt;" + html.EscapeString(link)
 }
 
-func ParseLinkComments(board activitypub.Actor, op string, content string, thread activitypub.ObjectBase) (string, error) {
-	re := regexp.MustCompile(`(>>(https?://[A-Za-z0-9_.:\-~]+\/[A-Za-z0-9_.\-~]+\/)(f[A-Za-z0-9_.\-~]+-)?([A-Za-z0-9_.\-~]+)?#?([A-Za-z0-9_.\-~]+)?)`)
-	match := re.FindAllStringSubmatch(content, -1)
+// BoardLinkHref returns the href the board link tag is rendered with. Local
+// boards and posts are linked relative so they work over tor too, and posts
+// on followed remote boards through their local path.
+func BoardLinkHref(tag activitypub.ObjectBase) string {
+	if !httpRe.MatchString(tag.Href) {
+		return ""
+	}
 
-	//add url to each matched reply
-	for i, _ := range match {
-		isOP := ""
-		domain := match[i][2]
-		link := strings.Replace(match[i][0], ">>", "", 1)
+	href := tag.Href
+	var reply string
 
-		if link == op {
-			isOP = " (OP)"
+	if tag.Type != "Mention" {
+		if op, _ := db.GetReplyOP(tag.Href); op != "" {
+			href, reply = op, tag.Href
 		}
+	}
 
-		parsedLink := ConvertHashLink(domain, link)
+	if board := GetFollowedBoard(href); board.Id != "" && !strings.HasPrefix(board.Id, config.Domain+"/") {
+		link := "/" + board.Name
 
-		//formate the hover title text
-		var quoteTitle string
+		if href != board.Id {
+			link += "/" + util.ShortURL(board.Outbox, href)
+		}
 
-		// if the quoted content is local get it
-		// else get it from the database
-		if thread.Id == link {
-			quoteTitle = ParseLinkTitle(board.Outbox, op, thread.Content)
-		} else {
-			for _, e := range thread.Replies.OrderedItems {
-				if e.Id == parsedLink {
-					quoteTitle = ParseLinkTitle(board.Outbox, op, e.Content)
-					break
-				}
-			}
+		if reply != "" {
+			link += "#" + util.ShortURL(board.Outbox, reply)
+		}
 
-			if quoteTitle == "" {
-				obj := activitypub.ObjectBase{Id: parsedLink}
-				col, err := obj.GetCollectionFromPath()
-				if err != nil {
-					return "", util.MakeError(err, "ParseLinkComments")
-				}
+		return link
+	}
 
-				if len(col.OrderedItems) > 0 {
-					quoteTitle = ParseLinkTitle(board.Outbox, op, col.OrderedItems[0].Content)
-				} else {
-					quoteTitle = ParseLinkTitle(board.Outbox, op, parsedLink)
+	if reply != "" {
+		href += "#" + util.ShortURL(href, reply)
+	}
+
+	if strings.HasPrefix(href, config.Domain+"/") {
+		href = strings.TrimPrefix(href, config.Domain)
+	}
+
+	return href
+}
+
+// ResolveBoardLinks returns the tags for the board links in content. Links to
+// boards or posts that can not be found are skipped.
+func ResolveBoardLinks(content string) []activitypub.ObjectBase {
+	var tags []activitypub.ObjectBase
+	var resolved []string
+
+	for _, link := range MarkupBoardLinks(ParseMarkup(content)) {
+		if util.IsInStringArray(resolved, link) {
+			continue
+		}
+
+		resolved = append(resolved, link)
+
+		tag, err := ResolveBoardLink(link)
+
+		if err != nil {
+			config.Log.Println(err)
+			continue
+		}
+
+		if tag.Href != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
+// ResolveBoardLink returns the tag for the board link >>>link, a Mention of
+// the board or a Link to the post. Boards without an instance are looked up
+// in the local and followed boards, others through webfinger.
+func ResolveBoardLink(link string) (activitypub.ObjectBase, error) {
+	var tag activitypub.ObjectBase
+	var actor activitypub.Actor
+	var err error
+
+	match := boardLinkRe.FindStringSubmatch(">>>" + link)
+
+	if match == nil {
+		return tag, nil
+	}
+
+	name, instance, num := match[1], strings.TrimPrefix(match[2], "@"), match[3]
+	local := instance == "" || instance == util.StripTransferProtocol(config.Domain)
+
+	if local {
+		if actor, _ = activitypub.GetActorByNameFromDB(name); actor.Id == "" && instance == "" {
+			for _, e := range webfinger.FollowingBoards {
+				if board, err := activitypub.FingerActor(e.Id); err == nil && board.Name == name {
+					actor = board
+					break
 				}
 			}
 		}
+	} else if actor, err = activitypub.FingerActor(name + "@" + instance); err != nil {
+		return tag, util.MakeError(err, "ResolveBoardLink")
+	}
+
+	if actor.Id == "" {
+		return tag, nil
+	}
 
-		if replyID, isReply, err := db.IsReplyToOP(op, parsedLink); err == nil && isReply || err == nil && parsedLink == op {
-			id := util.ShortURL(board.Outbox, replyID)
+	tag.Name = ">>>" + link
 
-			content = strings.Replace(content, match[i][0], "<a class=\"reply\" title=\""+quoteTitle+"\" href=\"/"+board.Name+"/"+util.ShortURL(board.Outbox, op)+"#"+id+"\">&gt;&gt;"+id+""+isOP+"</a>", -1)
-		} else {
-			//this is a cross post
+	if num == "" {
+		tag.Type = "Mention"
+		tag.Href = actor.Id
+		tag.Link = BoardLinkHref(tag)
 
-			parsedOP, err := db.GetReplyOP(parsedLink)
-			if err == nil && len(parsedOP) > 0 {
-				link = parsedOP + "#" + util.ShortURL(parsedOP, parsedLink)
-			} else {
-				// If we want to keep user on same instance then use current actor, or redirect them to the /main/ actor
-				//link, _ = db.GetPostIDFromNum(parsedLink)
-				if db.IsTombstone(parsedLink) {
-					return strings.Replace(content, match[i][0], "<a class=\"reply deadlink\">&gt;&gt;"+util.ShortURL(board.Outbox, parsedLink)+"</a>", -1), nil
-				}
+		return tag, nil
+	}
 
-				link = parsedLink
-			}
+	id := actor.Id + "/" + num
+
+	// posts on remote boards can not be checked without a request, link them as written
+	if strings.HasPrefix(actor.Id, config.Domain+"/") && !activitypub.IsPost(id) {
+		return tag, nil
+	}
+
+	tag.Type = "Link"
+	tag.MediaType = activitypub.ObjectLinkType
+	tag.Href = id
+	tag.Link = BoardLinkHref(tag)
+
+	return tag, nil
+}
 
-			// Disabled due to slow downs with tor
-			//actor, err := activitypub.FingerActor(parsedLink)
-			//if err == nil && actor.Id != "" {
-			content = strings.Replace(content, match[i][0], "<a class=\"reply\" title=\""+quoteTitle+"\" href=\""+link+"\">&gt;&gt;"+util.ShortURL(board.Outbox, parsedLink)+isOP+" →</a>", -1)
-			//}
+// GetFollowedBoard returns the followed board that is or has the post at id,
+// or an empty actor if id is not on a followed board.
+func GetFollowedBoard(id string) activitypub.Actor {
+	for _, e := range webfinger.FollowingBoards {
+		if id != e.Id && !strings.HasPrefix(id, e.Id+"/") {
+			continue
+		}
+
+		if board, err := activitypub.FingerActor(e.Id); err == nil {
+			return board
 		}
 	}
 
-	return content, nil
+	return activitypub.Actor{}
 }
 
-func ParseCommentQuotes(content string) string {
-	// replace quotes
-	re := regexp.MustCompile(`((\r\n|\r|\n|^)>(.+)?[^\r\n])`)
-	match := re.FindAllStringSubmatch(content, -1)
+// ParseQuoteLink returns the html for a quote of the post at link in a post of
+// the thread op on board.
+func ParseQuoteLink(board activitypub.Actor, op string, link string, thread activitypub.ObjectBase) (string, error) {
+	var domain string
 
-	for i, _ := range match {
-		quote := strings.Replace(match[i][0], ">", "&gt;", 1)
-		line := re.ReplaceAllString(match[i][0], "<span class=\"quote\">"+quote+"</span>")
-		content = strings.Replace(content, match[i][0], line, 1)
+	if match := quoteLinkRe.FindStringSubmatch(">>" + link); match != nil {
+		domain = match[1]
 	}
 
-	//replace isolated greater than symboles
-	re = regexp.MustCompile(`(\r\n|\n|\r)>`)
+	isOP := ""
 
-	return re.ReplaceAllString(content, "\r\n<span class=\"quote\">&gt;</span>")
-}
+	if link == op {
+		isOP = " (OP)"
+	}
 
-func ParseCommentSpoilers(content string) string {
-	re := regexp.MustCompile(`\[(\/)?spoiler]`)
-	content = re.ReplaceAllString(content, "<${1}s>")
-	return content
-}
+	parsedLink := ConvertHashLink(domain, link)
 
-func ParseCommentCode(content string) string {
-	re := regexp.MustCompile(`\[code\](?s)(.+?)\[/code\]`)
-	matches := re.FindAllStringSubmatch(content, -1)
-	for _, match := range matches {
-		content = strings.Replace(content, match[0], "<pre class='prettyprint'>"+match[1]+"</pre>", 1)
+	//formate the hover title text
+	var quoteTitle string
+
+	// if the quoted content is local get it
+	// else get it from the database
+	if thread.Id == link {
+		quoteTitle = ParseLinkTitle(board.Outbox, op, thread.Content)
+	} else {
+		for _, e := range thread.Replies.OrderedItems {
+			if e.Id == parsedLink {
+				quoteTitle = ParseLinkTitle(board.Outbox, op, e.Content)
+				break
+			}
+		}
+
+		if quoteTitle == "" {
+			obj := activitypub.ObjectBase{Id: parsedLink}
+			col, err := obj.GetCollectionFromPath()
+			if err != nil {
+				return "", util.MakeError(err, "ParseQuoteLink")
+			}
+
+			if len(col.OrderedItems) > 0 {
+				quoteTitle = ParseLinkTitle(board.Outbox, op, col.OrderedItems[0].Content)
+			} else {
+				quoteTitle = ParseLinkTitle(board.Outbox, op, parsedLink)
+			}
+		}
 	}
-	return content
+
+	quoteTitle = html.EscapeString(quoteTitle)
+
+	if replyID, isReply, err := db.IsReplyToOP(op, parsedLink); err == nil && isReply || err == nil && parsedLink == op {
+		id := util.ShortURL(board.Outbox, replyID)
+
+		return "<a class=\"reply\" title=\"" + quoteTitle + "\" href=\"/" + board.Name + "/" + util.ShortURL(board.Outbox, op) + "#" + id + "\">&gt;&gt;" + id + "" + isOP + "</a>", nil
+	}
+
+	//this is a cross post
+
+	parsedOP, err := db.GetReplyOP(parsedLink)
+	if err == nil && len(parsedOP) > 0 {
+		link = parsedOP + "#" + util.ShortURL(parsedOP, parsedLink)
+	} else {
+		// If we want to keep user on same instance then use current actor, or redirect them to the /main/ actor
+		//link, _ = db.GetPostIDFromNum(parsedLink)
+		if db.IsTombstone(parsedLink) {
+			return "<a class=\"reply deadlink\">&gt;&gt;" + html.EscapeString(util.ShortURL(board.Outbox, parsedLink)) + "</a>", nil
+		}
+
+		link = parsedLink
+	}
+
+	// Disabled due to slow downs with tor
+	//actor, err := activitypub.FingerActor(parsedLink)
+	//if err == nil && actor.Id != "" {
+	return "<a class=\"reply\" title=\"" + quoteTitle + "\" href=\"" + html.EscapeString(link) + "\">&gt;&gt;" + html.EscapeString(util.ShortURL(board.Outbox, parsedLink)) + isOP + " →</a>", nil
+	//}
 }
 
 // TODO: copy in package and change to work with HTML entities
@@ -707,34 +938,3 @@ func ParseCommentCodeTest(content string) string {
 	}
 	return content
 }
-
-// TODO: Overkill?
-func CloseUnclosedTags(content string) string {
-	// find all opening and closing tags
-	re := regexp.MustCompile(`<\/?[a-zA-Z]+[^>]*>`)
-	matches := re.FindAllStringIndex(content, -1)
-
-	// create a stack to keep track of open tags
-	stack := []string{}
-	for _, match := range matches {
-		tag := content[match[0]:match[1]]
-		if strings.HasPrefix(tag, "</") {
-			// closing tag, pop from stack
-			if len(stack) > 0 {
-				stack = stack[:len(stack)-1]
-			}
-		} else if !strings.HasPrefix(tag, "<br") {
-			// opening tag (not <br>), push to stack
-			stack = append(stack, tag)
-		}
-	}
-
-	// close all remaining open tags in reverse order
-	var builder strings.Builder
-	builder.WriteString(content)
-	for i := len(stack) - 1; i >= 0; i-- {
-		builder.WriteString("</" + stack[i][1:])
-	}
-
-	return builder.String()
-}
@@ -50,6 +50,24 @@ func ActorInbox(ctx *fiber.Ctx) error {
 
 	switch activity.Type {
 	case "Create":
+		// votes are recorded on the poll instead of being posted
+		if vote, _ := activity.Object.IsVote(); vote {
+			poll := activity.Object.InReplyTo[0]
+
+			// votes count once for each signing actor, whatever they are attributed to
+			if err := poll.Vote(activity.Actor.Id, []string{activity.Object.Name}); err != nil {
+				return util.MakeError(err, "ActorInbox")
+			}
+
+			go func() {
+				if err := poll.SendPollUpdate(); err != nil {
+					config.Log.Println(err)
+				}
+			}()
+
+			break
+		}
+
 		for _, e := range activity.To {
 			actor := activitypub.Actor{Id: e}
 			if err := actor.ProcessInboxCreate(activity); err != nil {
@@ -68,6 +86,17 @@ func ActorInbox(ctx *fiber.Ctx) error {
 			}
 		}
 
+		break
+	case "Update":
+		// new vote counts of a cached poll from its board
+		if len(activity.Object.PollChoices()) > 0 && strings.HasPrefix(activity.Object.Id, activity.Actor.Id+"/") {
+			if cached, _ := activity.Object.IsCached(); cached {
+				if err := activity.Object.UpdatePollCounts(); err != nil {
+					return util.MakeError(err, "ActorInbox")
+				}
+			}
+		}
+
 		break
 	case "Delete":
 		for _, e := range activity.To {
@@ -204,12 +233,44 @@ func ActorFollowers(ctx *fiber.Ctx) error {
 }
 
 func MakeActorPost(ctx *fiber.Ctx) error {
+	sendTo := ctx.FormValue("sendTo")
+
+	re := regexp.MustCompile(`.+\/`)
+	actorid := strings.TrimSuffix(re.FindString(ctx.FormValue("inReplyTo")), "/")
+	actor, err := activitypub.GetActor(actorid)
+	if err == nil {
+		local, _ := actor.IsLocal()
+		if local {
+			sendTo = actor.Outbox
+		}
+	} else {
+		query := `select id from following where following = $1 AND following != $2 LIMIT 1;`
+		if err := config.DB.QueryRow(query, actorid, config.Domain+"/overboard").Scan(&actorid); err == nil {
+			if actor, err := activitypub.GetActor(actorid); err == nil {
+				sendTo = actor.Outbox
+			}
+		}
+	}
+	//actorid := strings.TrimSuffix(re.FindString(ctx.FormValue("inReplyTo")), "/")
+	//sendTo = actorid + "/outbox"
+	//actor, _ := webfinger.GetActorFromPath(actorid, "/")
+	//sendTo = actor.Outbox
+	//}
+	//}
+
+	// bans are checked against the board the post is sent to
+	target, _ := activitypub.GetActorFromDB(strings.TrimSuffix(sendTo, "/outbox"))
+
 	var ban db.Ban
-	ban.IP, ban.Reason, ban.Date, ban.Expires, _ = db.IsIPBanned(ctx.IP())
+	ban.IP, ban.Reason, ban.Date, ban.Expires, _ = db.IsIPBanned(ctx.IP(), target.Name)
 	if len(ban.IP) > 1 {
 		return ctx.Redirect(ctx.BaseURL()+"/banned", 301)
 	}
 
+	if warnings, _ := db.GetUnacknowledgedWarnings(ctx.IP()); len(warnings) > 0 {
+		return WarningGet(ctx, warnings)
+	}
+
 	header, _ := ctx.FormFile("file")
 
 	if ctx.FormValue("inReplyTo") == "" && header == nil {
@@ -257,6 +318,10 @@ func MakeActorPost(ctx *fiber.Ctx) error {
 		return route.Send400(ctx, "Name, Subject, or Options field(s) contain more than 100 characters")
 	}
 
+	if len(ctx.FormValue("poll")) > 2000 {
+		return route.Send400(ctx, "Poll is longer than 2000 characters")
+	}
+
 	if ctx.FormValue("captcha") == "" {
 		return route.Send403(ctx, "No captcha provided")
 	}
@@ -322,31 +387,6 @@ func MakeActorPost(ctx *fiber.Ctx) error {
 
 	we.Close()
 
-	sendTo := ctx.FormValue("sendTo")
-
-	re := regexp.MustCompile(`.+\/`)
-	actorid := strings.TrimSuffix(re.FindString(ctx.FormValue("inReplyTo")), "/")
-	actor, err := activitypub.GetActor(actorid)
-	if err == nil {
-		local, _ := actor.IsLocal()
-		if local {
-			sendTo = actor.Outbox
-		}
-	} else {
-		query := `select id from following where following = $1 AND following != $2 LIMIT 1;`
-		if err := config.DB.QueryRow(query, actorid, config.Domain+"/overboard").Scan(&actorid); err == nil {
-			if actor, err := activitypub.GetActor(actorid); err == nil {
-				sendTo = actor.Outbox
-			}
-		}
-	}
-	//actorid := strings.TrimSuffix(re.FindString(ctx.FormValue("inReplyTo")), "/")
-	//sendTo = actorid + "/outbox"
-	//actor, _ := webfinger.GetActorFromPath(actorid, "/")
-	//sendTo = actor.Outbox
-	//}
-	//}
-
 	req, err := http.NewRequest("POST", sendTo, &b)
 
 	if err != nil {
@@ -356,6 +396,11 @@ func MakeActorPost(ctx *fiber.Ctx) error {
 	req.Header.Set("Content-Type", we.FormDataContentType())
 	req.Header.Set("PosterIP", ctx.IP())
 
+	// the session is only sent to our own boards so staff can post capcoded
+	if strings.HasPrefix(sendTo, config.Domain+"/") && ctx.Cookies("session_token") != "" {
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: ctx.Cookies("session_token")})
+	}
+
 	resp, err := util.RouteProxy(req)
 
 	if err != nil {
@@ -394,6 +439,10 @@ func MakeActorPost(ctx *fiber.Ctx) error {
 		})
 	}
 
+	if resp.StatusCode == http.StatusAccepted {
+		return route.SendMessage(ctx, string(body))
+	}
+
 	return ctx.Redirect(ctx.BaseURL()+"/"+ctx.FormValue("boardName"), 301)
 }
 
@@ -438,6 +487,26 @@ func ActorPost(ctx *fiber.Ctx) error {
 		data.Posts = append(data.Posts, collection.OrderedItems[0])
 	}
 
+	// mods can list the posts of one poster id in the thread
+	posterID := ctx.Query("posterid")
+
+	if _, auth := util.GetPasswordFromSession(ctx); posterID != "" && len(data.Posts) > 0 {
+		if has, _ := util.HasAuth(auth, actor.Id); has {
+			var replies []activitypub.ObjectBase
+
+			for _, e := range data.Posts[0].Replies.OrderedItems {
+				if e.PosterId == posterID {
+					replies = append(replies, e)
+				}
+			}
+
+			data.Posts[0].Replies.OrderedItems = replies
+			data.Posts[0].Replies.TotalItems = len(replies)
+		} else {
+			posterID = ""
+		}
+	}
+
 	data.Board.Name = actor.Name
 	data.Board.PrefName = actor.PreferredUsername
 	data.Board.To = actor.Outbox
@@ -470,6 +539,10 @@ func ActorPost(ctx *fiber.Ctx) error {
 
 	data.Title = "/" + data.Board.Name + "/ - " + data.PostId
 
+	if posterID != "" {
+		data.Title = data.Title + " - ID: " + posterID
+	}
+
 	if len(data.Posts) > 0 {
 		data.Meta.Description = data.Posts[0].Content
 		data.Meta.Url = data.Posts[0].Id
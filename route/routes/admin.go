@@ -8,11 +8,13 @@ import (
 	"net/http"
 	"regexp"
 	"sort"
+	"strconv"
 	"time"
 
 	"github.com/FChannel0/FChannel-Server/activitypub"
 	"github.com/FChannel0/FChannel-Server/config"
 	"github.com/FChannel0/FChannel-Server/db"
+	"github.com/FChannel0/FChannel-Server/post"
 	"github.com/FChannel0/FChannel-Server/route"
 	"github.com/FChannel0/FChannel-Server/util"
 	"github.com/FChannel0/FChannel-Server/webfinger"
@@ -86,7 +88,7 @@ func AdminAuth(ctx *fiber.Ctx) error {
 }
 
 func AdminIndex(ctx *fiber.Ctx) error {
-	id, _ := util.GetPasswordFromSession(ctx)
+	id, pass := util.GetPasswordFromSession(ctx)
 	actor, _ := webfinger.GetActorFromPath(ctx.Path(), "/"+config.Key+"/")
 
 	if actor.Id == "" {
@@ -153,6 +155,19 @@ func AdminIndex(ctx *fiber.Ctx) error {
 
 	adminData.PostBlacklist, _ = util.GetRegexBlacklist()
 
+	adminData.BannedImages, _ = db.GetBannedImages()
+	adminData.BannedHashes, _ = db.GetBannedHashes()
+
+	adminData.Staff, _ = util.GetStaffAccess(pass, config.Domain)
+	if adminData.Staff.Role == util.RoleOwner {
+		adminData.Appeals, _ = db.GetPendingAppeals("")
+	}
+
+	adminData.ModLogActions = db.ModActions
+	adminData.ModLogAction = ctx.Query("logaction")
+	adminData.ModLogStaff = ctx.Query("logstaff")
+	adminData.ModLog, _ = db.GetModLog("", adminData.ModLogAction, adminData.ModLogStaff, 100)
+
 	adminData.Meta.Description = adminData.Title
 	adminData.Meta.Url = adminData.Board.Actor.Id
 	adminData.Meta.Title = adminData.Title
@@ -302,6 +317,34 @@ func AdminActorIndex(ctx *fiber.Ctx) error {
 	data.Instance, _ = activitypub.GetActorFromDB(config.Domain)
 
 	data.AutoSubscribe, _ = actor.GetAutoSubscribe()
+	data.PosterIDs, _ = actor.GetPosterIDs()
+	data.Flags, _ = actor.GetFlags()
+	data.Dice, _ = actor.GetDice()
+	data.R9K, _ = actor.GetR9K()
+	data.Premoderation, _ = actor.GetPremoderation()
+	data.PublicModLog, _ = actor.GetPublicModLog()
+	data.Pending, _ = actor.GetPending()
+	data.Filters, _ = db.GetBoardFilters(actor.Id)
+
+	if sample := ctx.Query("filtertest"); sample != "" {
+		data.FilterTest = sample
+		data.FilterTestResult, data.FilterTestMatches = post.MatchFilters(data.Filters, sample)
+	}
+	data.ThreadCooldown, data.ReplyCooldown, data.DuplicateCooldown, _ = actor.GetCooldowns()
+	data.SpamHold, data.SpamReject, _ = actor.GetSpamThresholds()
+	data.Staff, _ = util.GetStaffAccess(pass, actor.Id)
+	data.Permissions = util.Permissions
+
+	if data.Staff.Can(util.PermBan) {
+		data.Appeals, _ = db.GetPendingAppeals(actor.Name)
+	}
+
+	if data.Board.ModCred == "admin" {
+		data.ModLogActions = db.ModActions
+		data.ModLogAction = ctx.Query("logaction")
+		data.ModLogStaff = ctx.Query("logstaff")
+		data.ModLog, _ = db.GetModLog(actor.Name, data.ModLogAction, data.ModLogStaff, 100)
+	}
 
 	jannies, err := actor.GetJanitors()
 
@@ -336,17 +379,59 @@ func AdminAddJanny(ctx *fiber.Ctx) error {
 		actor, _ = activitypub.GetActorByNameFromDB(config.Domain)
 	}
 
-	hasAuth, _type := util.HasAuth(pass, actor.Id)
+	access, _ := util.GetStaffAccess(pass, actor.Id)
 
-	if !hasAuth || _type != "admin" || (id != actor.Id && id != config.Domain) {
+	if !access.Can(util.PermStaff) || (id != actor.Id && id != config.Domain) {
 		return util.MakeError(errors.New("Error"), "AdminJanny")
 	}
 
 	var verify util.Verify
-	verify.Type = "janitor"
+	verify.Type = ctx.FormValue("role", util.RoleJanitor)
 	verify.Identifier = actor.Id
 	verify.Label = ctx.FormValue("label")
 
+	switch verify.Type {
+	case util.RoleJanitor, util.RoleModerator:
+		verify.Permissions = util.RolePermissions[verify.Type]
+		verify.BanMax = util.RoleBanMax[verify.Type]
+	case util.RoleCustom:
+		for _, e := range util.Permissions {
+			if ctx.FormValue("perm-"+e) == "on" {
+				verify.Permissions = append(verify.Permissions, e)
+			}
+		}
+
+		// the longest ban has to be given for staff who can ban
+		if util.IsInStringArray(verify.Permissions, util.PermBan) {
+			if ctx.FormValue("banunlimited") == "on" {
+				verify.BanMax = util.BanUnlimited
+			} else if days, err := strconv.Atoi(ctx.FormValue("banmax")); err != nil || days < 1 {
+				return route.Send400(ctx, "Longest ban must be at least one day or have no limit")
+			} else {
+				verify.BanMax = days * 24 * 60 * 60
+			}
+		}
+	default:
+		return route.Send400(ctx, "Unknown role")
+	}
+
+	// staff can only hand out what they are allowed to do themselves
+	for _, e := range verify.Permissions {
+		if !access.Can(e) {
+			return route.Send403(ctx, "You can not give the "+e+" permission")
+		}
+	}
+
+	if access.BanMax != util.BanUnlimited && (verify.BanMax == util.BanUnlimited || verify.BanMax > access.BanMax) {
+		return route.Send403(ctx, "You can not give longer bans than your own")
+	}
+
+	// only the stored permissions of custom staff are read back
+	if verify.Type != util.RoleCustom {
+		verify.Permissions = nil
+		verify.BanMax = 0
+	}
+
 	if err := actor.CreateVerification(verify); err != nil {
 		return util.MakeError(err, "CreateNewBoardDB")
 	}
@@ -391,7 +476,7 @@ func AdminEditSummary(ctx *fiber.Ctx) error {
 
 }
 
-func AdminDeleteJanny(ctx *fiber.Ctx) error {
+func AdminEditCooldowns(ctx *fiber.Ctx) error {
 	id, pass := util.GetPasswordFromSession(ctx)
 	actor, _ := webfinger.GetActorFromPath(ctx.Path(), "/"+config.Key+"/")
 
@@ -402,12 +487,163 @@ func AdminDeleteJanny(ctx *fiber.Ctx) error {
 	hasAuth, _type := util.HasAuth(pass, actor.Id)
 
 	if !hasAuth || _type != "admin" || (id != actor.Id && id != config.Domain) {
+		return util.MakeError(errors.New("Error"), "AdminEditCooldowns")
+	}
+
+	var cooldowns []int
+	for _, e := range []string{"threadcooldown", "replycooldown", "duplicatecooldown"} {
+		seconds, err := strconv.Atoi(ctx.FormValue(e))
+
+		if err != nil || seconds < 0 || seconds > 86400 {
+			return route.Send400(ctx, "Cooldowns must be between 0 and 86400 seconds")
+		}
+
+		cooldowns = append(cooldowns, seconds)
+	}
+
+	if err := actor.SetCooldowns(cooldowns[0], cooldowns[1], cooldowns[2]); err != nil {
+		return util.MakeError(err, "AdminEditCooldowns")
+	}
+
+	var redirect string
+	if actor.Name != "main" {
+		redirect = actor.Name
+	}
+
+	return ctx.Redirect("/"+config.Key+"/"+redirect, http.StatusSeeOther)
+}
+
+func AdminEditSpam(ctx *fiber.Ctx) error {
+	id, pass := util.GetPasswordFromSession(ctx)
+	actor, _ := webfinger.GetActorFromPath(ctx.Path(), "/"+config.Key+"/")
+
+	if actor.Id == "" {
+		actor, _ = activitypub.GetActorByNameFromDB(config.Domain)
+	}
+
+	hasAuth, _type := util.HasAuth(pass, actor.Id)
+
+	if !hasAuth || _type != "admin" || (id != actor.Id && id != config.Domain) {
+		return util.MakeError(errors.New("Error"), "AdminEditSpam")
+	}
+
+	hold, err := strconv.Atoi(ctx.FormValue("spamhold"))
+	if err != nil || hold < 0 {
+		return route.Send400(ctx, "Spam thresholds must be 0 or more")
+	}
+
+	reject, err := strconv.Atoi(ctx.FormValue("spamreject"))
+	if err != nil || reject < 0 {
+		return route.Send400(ctx, "Spam thresholds must be 0 or more")
+	}
+
+	if err := actor.SetSpamThresholds(hold, reject); err != nil {
+		return util.MakeError(err, "AdminEditSpam")
+	}
+
+	var redirect string
+	if actor.Name != "main" {
+		redirect = actor.Name
+	}
+
+	return ctx.Redirect("/"+config.Key+"/"+redirect+"#spam", http.StatusSeeOther)
+}
+
+func AdminAddFilter(ctx *fiber.Ctx) error {
+	id, pass := util.GetPasswordFromSession(ctx)
+	actor, _ := webfinger.GetActorFromPath(ctx.Path(), "/"+config.Key+"/")
+
+	if actor.Id == "" {
+		actor, _ = activitypub.GetActorByNameFromDB(config.Domain)
+	}
+
+	hasAuth, _type := util.HasAuth(pass, actor.Id)
+
+	if !hasAuth || _type != "admin" || (id != actor.Id && id != config.Domain) {
+		return util.MakeError(errors.New("Error"), "AdminAddFilter")
+	}
+
+	var filter db.BoardFilter
+	filter.Actor = actor.Id
+	filter.Regex = ctx.FormValue("regex")
+	filter.Action = ctx.FormValue("action")
+	filter.Replacement = util.EscapeString(ctx.FormValue("replacement"))
+	filter.Message = ctx.FormValue("message")
+	filter.Duration, _ = strconv.Atoi(ctx.FormValue("duration"))
+
+	if _, err := regexp.Compile(filter.Regex); err != nil || filter.Regex == "" || len(filter.Regex) > 200 {
+		return route.Send400(ctx, "Filter is not a valid regular expression")
+	}
+
+	if !util.IsInStringArray(db.FilterActions, filter.Action) {
+		return route.Send400(ctx, "Invalid filter action")
+	}
+
+	if len(filter.Replacement) > 200 || len(filter.Message) > 512 || filter.Duration < 0 {
+		return route.Send400(ctx, "Filter replacement or message is too long")
+	}
+
+	if err := db.WriteBoardFilter(filter); err != nil {
+		return util.MakeError(err, "AdminAddFilter")
+	}
+
+	var redirect string
+	if actor.Name != "main" {
+		redirect = actor.Name
+	}
+
+	return ctx.Redirect("/"+config.Key+"/"+redirect+"#filters", http.StatusSeeOther)
+}
+
+func AdminDeleteFilter(ctx *fiber.Ctx) error {
+	id, pass := util.GetPasswordFromSession(ctx)
+	actor, _ := webfinger.GetActorFromPath(ctx.Path(), "/"+config.Key+"/")
+
+	if actor.Id == "" {
+		actor, _ = activitypub.GetActorByNameFromDB(config.Domain)
+	}
+
+	hasAuth, _type := util.HasAuth(pass, actor.Id)
+
+	if !hasAuth || _type != "admin" || (id != actor.Id && id != config.Domain) {
+		return util.MakeError(errors.New("Error"), "AdminDeleteFilter")
+	}
+
+	filter, _ := strconv.Atoi(ctx.Query("id"))
+
+	if err := db.DeleteBoardFilter(actor.Id, filter); err != nil {
+		return util.MakeError(err, "AdminDeleteFilter")
+	}
+
+	var redirect string
+	if actor.Name != "main" {
+		redirect = actor.Name
+	}
+
+	return ctx.Redirect("/"+config.Key+"/"+redirect+"#filters", http.StatusSeeOther)
+}
+
+func AdminDeleteJanny(ctx *fiber.Ctx) error {
+	id, pass := util.GetPasswordFromSession(ctx)
+	actor, _ := webfinger.GetActorFromPath(ctx.Path(), "/"+config.Key+"/")
+
+	if actor.Id == "" {
+		actor, _ = activitypub.GetActorByNameFromDB(config.Domain)
+	}
+
+	access, _ := util.GetStaffAccess(pass, actor.Id)
+
+	if !access.Can(util.PermStaff) || (id != actor.Id && id != config.Domain) {
 		return util.MakeError(errors.New("Error"), "AdminJanny")
 	}
 
 	var verify util.Verify
 	verify.Code = ctx.Query("code")
 
+	if verify.Code == pass {
+		return route.Send400(ctx, "You can not remove yourself")
+	}
+
 	if err := actor.DeleteVerification(verify); err != nil {
 		return util.MakeError(err, "AdminDeleteJanny")
 	}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/FChannel0/FChannel-Server/config"
+	"github.com/FChannel0/FChannel-Server/storage"
 	"github.com/FChannel0/FChannel-Server/util"
 	"github.com/gofiber/fiber/v2"
 )
@@ -18,6 +19,22 @@ func Media(ctx *fiber.Ctx) error {
 	return ctx.SendStatus(404)
 }
 
+// PublicMedia redirects to media that is not on local disk, such as files in
+// an S3 bucket. Local files are served by the static /public route first.
+func PublicMedia(ctx *fiber.Ctx) error {
+	if _, ok := storage.Store.(storage.Local); ok {
+		return ctx.Status(404).Render("404", fiber.Map{})
+	}
+
+	url, err := storage.Store.URL(ctx.Params("file"))
+
+	if err != nil {
+		return util.MakeError(err, "PublicMedia")
+	}
+
+	return ctx.Redirect(url, http.StatusFound)
+}
+
 func RouteImages(ctx *fiber.Ctx, media string) error {
 	req, err := http.NewRequest("GET", config.MediaHashs[media], nil)
 	if err != nil {
@@ -1,6 +1,10 @@
 package routes
 
 import (
+	"net/http"
+	"strconv"
+	"strings"
+
 	"github.com/FChannel0/FChannel-Server/activitypub"
 	"github.com/FChannel0/FChannel-Server/config"
 	"github.com/FChannel0/FChannel-Server/db"
@@ -37,12 +41,62 @@ func BannedGet(ctx *fiber.Ctx) error {
 	data.Themes = &config.Themes
 	data.ThemeCookie = route.GetThemeCookie(ctx)
 
-	var banned db.Ban
+	bans, _ := db.GetActiveBans(ctx.IP())
+	appeals, _ := db.GetBanAppeals(ctx.IP())
+	outcomes, _ := db.GetAppealOutcomes(ctx.IP())
+
+	return ctx.Render("banned", fiber.Map{"page": data, "bans": bans, "appeals": appeals, "outcomes": outcomes, "ip": ctx.IP()}, "layouts/main")
+}
+
+func BannedAppeal(ctx *fiber.Ctx) error {
+	id, _ := strconv.Atoi(ctx.FormValue("ban"))
+	message := strings.TrimSpace(ctx.FormValue("message"))
+
+	if message == "" {
+		return route.Send400(ctx, "Your appeal is empty")
+	}
+
+	if len(message) > 2000 {
+		return route.Send400(ctx, "Appeal is longer than 2000 characters")
+	}
+
+	ban, err := db.GetBanForIP(id, ctx.IP())
+
+	if err != nil {
+		return route.Send404(ctx, "Ban not found")
+	}
+
+	if err := db.CreateAppeal(ban, message); err != nil {
+		return util.MakeError(err, "BannedAppeal")
+	}
+
+	return ctx.Redirect("/banned", http.StatusSeeOther)
+}
+
+// WarningGet shows the poster the warnings they were given, they can not post
+// again until they acknowledged them.
+func WarningGet(ctx *fiber.Ctx, warnings []db.Warning) error {
+	var data route.PageData
+
+	data.Boards = webfinger.Boards
+	data.Themes = &config.Themes
+	data.ThemeCookie = route.GetThemeCookie(ctx)
+	data.Referer = ctx.Get("referer")
+
+	return ctx.Status(403).Render("warning", fiber.Map{"page": data, "warnings": warnings, "last": warnings[len(warnings)-1].Id}, "layouts/main")
+}
+
+func WarningAcknowledge(ctx *fiber.Ctx) error {
+	id, _ := strconv.Atoi(ctx.FormValue("id"))
+
+	if err := db.AcknowledgeWarnings(ctx.IP(), id); err != nil {
+		return util.MakeError(err, "WarningAcknowledge")
+	}
 
-	banned.IP, banned.Reason, banned.Date, banned.Expires, _ = db.IsIPBanned(ctx.IP())
-	if len(banned.IP) > 0 {
-		banned.IP = ctx.IP()
+	referer := ctx.FormValue("referer")
+	if !strings.HasPrefix(referer, config.Domain+"/") {
+		referer = "/"
 	}
 
-	return ctx.Render("banned", fiber.Map{"page": data, "banned": banned}, "layouts/main")
+	return ctx.Redirect(referer, http.StatusSeeOther)
 }
@@ -3,13 +3,9 @@ package routes
 import (
 	"errors"
 	"fmt"
-	"image"
-	_ "image/gif"
-	_ "image/jpeg"
-	_ "image/png"
 	"net/http"
 	"net/smtp"
-	"os"
+	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
@@ -19,7 +15,6 @@ import (
 	"github.com/FChannel0/FChannel-Server/config"
 	"github.com/FChannel0/FChannel-Server/route"
 	"github.com/FChannel0/FChannel-Server/webfinger"
-	"github.com/corona10/goimagehash"
 
 	"github.com/FChannel0/FChannel-Server/db"
 	"github.com/FChannel0/FChannel-Server/post"
@@ -60,57 +55,17 @@ func BoardBanMedia(ctx *fiber.Ctx) error {
 	var actor activitypub.Actor
 	actor.Id = col.OrderedItems[0].Actor
 
-	if has, _ := util.HasAuth(auth, actor.Id); !has {
+	if has := util.HasPermission(auth, actor.Id, util.PermBan); !has {
 		err = errors.New("actor does not have auth")
 		return util.MakeError(err, "BoardBanMedia")
 	}
 
-	re := regexp.MustCompile(config.Domain)
-	file := re.ReplaceAllString(col.OrderedItems[0].Attachment[0].Href, "")
+	note := ctx.Query("note")
 
-	f, err := os.Open("." + file)
-
-	if err != nil {
+	if err := post.BanMedia(col.OrderedItems[0].Attachment[0].Href, note); err != nil {
 		return util.MakeError(err, "BoardBanMedia")
 	}
 
-	defer f.Close()
-
-	//TODO: Fall back to old method if anything fails
-	mimetype, _ := util.GetFileContentType(f)
-	config.Log.Println("mimetype: " +  mimetype)
-	if mimetype == "image/jpeg" || mimetype == "image/png" || mimetype == "image/gif" {
-		image, _, err := image.Decode(f)
-		if err != nil {
-			return util.MakeError(err, "BoardBanMedia")
-		}
-		
-		phash, err := goimagehash.PerceptionHash(image)
-		if err != nil {
-			return util.MakeError(err, "BoardBanMedia")
-		}
-
-		config.Log.Println("Banning hash: ", uint64(phash.GetHash()))
-		
-		query := `insert into bannedimages (phash) values ($1)`
-		if _, err := config.DB.Exec(query, uint64(phash.GetHash())); err != nil {
-			return util.MakeError(err, "BoardBanMedia")
-		}
-	} else {
-	bytes := make([]byte, 2048)
-
-	if _, err = f.Read(bytes); err != nil {
-		return util.MakeError(err, "BoardBanMedia")
-	}
-
-	if banned, err := post.IsMediaBanned(f); err == nil && !banned {
-		query := `insert into bannedmedia (hash) values ($1)`
-		if _, err := config.DB.Exec(query, util.HashBytes(bytes)); err != nil {
-			return util.MakeError(err, "BoardBanMedia")
-			}
-		}
-	}
-
 	var isOP bool
 	var local bool
 	var obj activitypub.ObjectBase
@@ -137,6 +92,35 @@ func BoardBanMedia(ctx *fiber.Ctx) error {
 		return util.MakeError(err, "BoardBanMedia")
 	}
 
+	if err := route.LogModAction(ctx, db.ModLogEntry{Board: board, Action: db.ModBanMedia, Target: postID, Note: note}); err != nil {
+		return util.MakeError(err, "BoardBanMedia")
+	}
+
+	// identical uploads share one file, remove every other post using it
+	references, err := activitypub.GetMediaReferences(col.OrderedItems[0].Attachment[0].Href)
+
+	if err != nil {
+		return util.MakeError(err, "BoardBanMedia")
+	}
+
+	for _, e := range references {
+		if e.Id == postID {
+			continue
+		}
+
+		if has := util.HasPermission(auth, e.Actor, util.PermBan); !has {
+			continue
+		}
+
+		if err := e.Tombstone(); err != nil {
+			return util.MakeError(err, "BoardBanMedia")
+		}
+
+		if err := e.DeleteRequest(); err != nil {
+			return util.MakeError(err, "BoardBanMedia")
+		}
+	}
+
 	var OP string
 	if len(col.OrderedItems[0].InReplyTo) > 0 {
 		OP = col.OrderedItems[0].InReplyTo[0].Id
@@ -192,7 +176,7 @@ func BoardDelete(ctx *fiber.Ctx) error {
 		actor.Id = col.OrderedItems[0].Actor
 	}
 
-	if has, _ := util.HasAuth(auth, actor.Id); !has {
+	if has := util.HasPermission(auth, actor.Id, util.PermDelete); !has {
 		err = errors.New("actor does not have auth")
 		return util.MakeError(err, "BoardDelete")
 	}
@@ -222,6 +206,10 @@ func BoardDelete(ctx *fiber.Ctx) error {
 		return util.MakeError(err, "BoardDelete")
 	}
 
+	if err := route.LogModAction(ctx, db.ModLogEntry{Board: board, Action: db.ModDelete, Target: postID}); err != nil {
+		return util.MakeError(err, "BoardDelete")
+	}
+
 	if ctx.Query("manage") == "t" {
 		return ctx.Redirect("/"+config.Key+"/"+board, http.StatusSeeOther)
 	}
@@ -276,6 +264,11 @@ func BoardDeleteAttach(ctx *fiber.Ctx) error {
 		actor.Id = col.OrderedItems[0].Actor
 	}
 
+	if has := util.HasPermission(auth, actor.Id, util.PermDelete); !has {
+		err = errors.New("actor does not have auth")
+		return util.MakeError(err, "BoardDeleteAttach")
+	}
+
 	obj := activitypub.ObjectBase{Id: postID}
 
 	if err := obj.DeleteAttachmentFromFile(); err != nil {
@@ -294,6 +287,10 @@ func BoardDeleteAttach(ctx *fiber.Ctx) error {
 		return util.MakeError(err, "BoardDeleteAttach")
 	}
 
+	if err := route.LogModAction(ctx, db.ModLogEntry{Board: board, Action: db.ModDeleteAttach, Target: postID}); err != nil {
+		return util.MakeError(err, "BoardDeleteAttach")
+	}
+
 	if ctx.Query("manage") == "t" {
 		return ctx.Redirect("/"+config.Key+"/"+board, http.StatusSeeOther)
 	} else if local, _ := obj.IsLocal(); !local && OP != "" {
@@ -344,7 +341,7 @@ func BoardMarkSensitive(ctx *fiber.Ctx) error {
 		actor.Id = col.OrderedItems[0].Actor
 	}
 
-	if has, _ := util.HasAuth(auth, actor.Id); !has {
+	if has := util.HasPermission(auth, actor.Id, util.PermDelete); !has {
 		err = errors.New("actor does not have auth")
 		return util.MakeError(err, "BoardMarkSensitive")
 	}
@@ -355,6 +352,10 @@ func BoardMarkSensitive(ctx *fiber.Ctx) error {
 		return util.MakeError(err, "BoardMarkSensitive")
 	}
 
+	if err := route.LogModAction(ctx, db.ModLogEntry{Board: board, Action: db.ModMarkSensitive, Target: postID}); err != nil {
+		return util.MakeError(err, "BoardMarkSensitive")
+	}
+
 	if isOP, _ := obj.CheckIfOP(); !isOP && OP != "" {
 		if local, _ := obj.IsLocal(); !local {
 			return ctx.Redirect("/"+board+"/"+util.RemoteShort(OP), http.StatusSeeOther)
@@ -376,6 +377,94 @@ func BoardAddToIndex(ctx *fiber.Ctx) error {
 	return ctx.SendString("board add to index")
 }
 
+func BoardApprove(ctx *fiber.Ctx) error {
+	postID := ctx.Query("id")
+	board := ctx.Query("board")
+
+	_, auth := util.GetPasswordFromSession(ctx)
+
+	if postID == "" || auth == "" {
+		return util.MakeError(errors.New("missing postID or auth"), "BoardApprove")
+	}
+
+	actor, err := activitypub.GetActorByNameFromDB(board)
+
+	if err != nil {
+		return util.MakeError(err, "BoardApprove")
+	}
+
+	if has := util.HasPermission(auth, actor.Id, util.PermDelete); !has {
+		return util.MakeError(errors.New("actor does not have auth"), "BoardApprove")
+	}
+
+	obj, err := actor.Approve(activitypub.ObjectBase{Id: postID})
+
+	if err != nil {
+		return util.MakeError(err, "BoardApprove")
+	}
+
+	if err := route.LogModAction(ctx, db.ModLogEntry{Board: board, Action: db.ModApprove, Target: postID}); err != nil {
+		return util.MakeError(err, "BoardApprove")
+	}
+
+	if local, _ := obj.IsLocal(); local {
+		if err := actor.ArchivePosts(); err != nil {
+			return util.MakeError(err, "BoardApprove")
+		}
+
+		go func(obj activitypub.ObjectBase) {
+			activity, err := obj.CreateActivity("Create")
+			if err != nil {
+				config.Log.Printf("BoardApprove Create Activity: %s", err)
+			}
+
+			activity, err = activity.AddFollowersTo()
+			if err != nil {
+				config.Log.Printf("BoardApprove Add FollowersTo: %s", err)
+			}
+
+			if err := activity.MakeRequestInbox(); err != nil {
+				config.Log.Printf("BoardApprove MakeRequestInbox: %s", err)
+			}
+		}(obj)
+	}
+
+	return ctx.Redirect("/"+config.Key+"/"+board+"#pending", http.StatusSeeOther)
+}
+
+func BoardReject(ctx *fiber.Ctx) error {
+	postID := ctx.Query("id")
+	board := ctx.Query("board")
+
+	_, auth := util.GetPasswordFromSession(ctx)
+
+	if postID == "" || auth == "" {
+		return util.MakeError(errors.New("missing postID or auth"), "BoardReject")
+	}
+
+	actor, err := activitypub.GetActorByNameFromDB(board)
+
+	if err != nil {
+		return util.MakeError(err, "BoardReject")
+	}
+
+	if has := util.HasPermission(auth, actor.Id, util.PermDelete); !has {
+		return util.MakeError(errors.New("actor does not have auth"), "BoardReject")
+	}
+
+	reason := util.EscapeString(ctx.Query("reason"))
+
+	if err := actor.Reject(activitypub.ObjectBase{Id: postID}, reason); err != nil {
+		return util.MakeError(err, "BoardReject")
+	}
+
+	if err := route.LogModAction(ctx, db.ModLogEntry{Board: board, Action: db.ModReject, Target: postID, Reason: reason}); err != nil {
+		return util.MakeError(err, "BoardReject")
+	}
+
+	return ctx.Redirect("/"+config.Key+"/"+board+"#pending", http.StatusSeeOther)
+}
+
 func BoardPopArchive(ctx *fiber.Ctx) error {
 	actor, err := activitypub.GetActorFromDB(config.Domain)
 
@@ -389,6 +478,15 @@ func BoardPopArchive(ctx *fiber.Ctx) error {
 
 	id := ctx.Query("id")
 	board := ctx.Query("board")
+	_, auth := util.GetPasswordFromSession(ctx)
+
+	if actor, err = activitypub.GetActorByNameFromDB(board); err != nil {
+		return util.MakeError(err, "BoardPopArchive")
+	}
+
+	if access, _ := util.GetStaffAccess(auth, actor.Id); access.Role != util.RoleOwner {
+		return util.MakeError(errors.New("actor does not have auth"), "BoardPopArchive")
+	}
 
 	var obj = activitypub.ObjectBase{Id: id}
 
@@ -411,11 +509,16 @@ func BoardAutoSubscribe(ctx *fiber.Ctx) error {
 	}
 
 	board := ctx.Query("board")
+	_, auth := util.GetPasswordFromSession(ctx)
 
 	if actor, err = activitypub.GetActorByNameFromDB(board); err != nil {
 		return util.MakeError(err, "BoardAutoSubscribe")
 	}
 
+	if access, _ := util.GetStaffAccess(auth, actor.Id); access.Role != util.RoleOwner {
+		return util.MakeError(errors.New("actor does not have auth"), "BoardAutoSubscribe")
+	}
+
 	if err := actor.SetAutoSubscribe(); err != nil {
 		return util.MakeError(err, "BoardAutoSubscribe")
 	}
@@ -429,6 +532,180 @@ func BoardAutoSubscribe(ctx *fiber.Ctx) error {
 	return ctx.Redirect("/"+config.Key+"/"+board, http.StatusSeeOther)
 }
 
+func BoardDice(ctx *fiber.Ctx) error {
+	actor, err := activitypub.GetActorFromDB(config.Domain)
+
+	if err != nil {
+		return util.MakeError(err, "BoardDice")
+	}
+
+	if has := actor.HasValidation(ctx); !has {
+		return util.MakeError(err, "BoardDice")
+	}
+
+	board := ctx.Query("board")
+	_, auth := util.GetPasswordFromSession(ctx)
+
+	if actor, err = activitypub.GetActorByNameFromDB(board); err != nil {
+		return util.MakeError(err, "BoardDice")
+	}
+
+	if access, _ := util.GetStaffAccess(auth, actor.Id); access.Role != util.RoleOwner {
+		return util.MakeError(errors.New("actor does not have auth"), "BoardDice")
+	}
+
+	if err := actor.SetDice(); err != nil {
+		return util.MakeError(err, "BoardDice")
+	}
+
+	return ctx.Redirect("/"+config.Key+"/"+board, http.StatusSeeOther)
+}
+
+func BoardR9K(ctx *fiber.Ctx) error {
+	actor, err := activitypub.GetActorFromDB(config.Domain)
+
+	if err != nil {
+		return util.MakeError(err, "BoardR9K")
+	}
+
+	if has := actor.HasValidation(ctx); !has {
+		return util.MakeError(err, "BoardR9K")
+	}
+
+	board := ctx.Query("board")
+	_, auth := util.GetPasswordFromSession(ctx)
+
+	if actor, err = activitypub.GetActorByNameFromDB(board); err != nil {
+		return util.MakeError(err, "BoardR9K")
+	}
+
+	if access, _ := util.GetStaffAccess(auth, actor.Id); access.Role != util.RoleOwner {
+		return util.MakeError(errors.New("actor does not have auth"), "BoardR9K")
+	}
+
+	if err := actor.SetR9K(); err != nil {
+		return util.MakeError(err, "BoardR9K")
+	}
+
+	return ctx.Redirect("/"+config.Key+"/"+board, http.StatusSeeOther)
+}
+
+func BoardPremoderation(ctx *fiber.Ctx) error {
+	actor, err := activitypub.GetActorFromDB(config.Domain)
+
+	if err != nil {
+		return util.MakeError(err, "BoardPremoderation")
+	}
+
+	if has := actor.HasValidation(ctx); !has {
+		return util.MakeError(err, "BoardPremoderation")
+	}
+
+	board := ctx.Query("board")
+	_, auth := util.GetPasswordFromSession(ctx)
+
+	if actor, err = activitypub.GetActorByNameFromDB(board); err != nil {
+		return util.MakeError(err, "BoardPremoderation")
+	}
+
+	if access, _ := util.GetStaffAccess(auth, actor.Id); access.Role != util.RoleOwner {
+		return util.MakeError(errors.New("actor does not have auth"), "BoardPremoderation")
+	}
+
+	if err := actor.SetPremoderation(); err != nil {
+		return util.MakeError(err, "BoardPremoderation")
+	}
+
+	return ctx.Redirect("/"+config.Key+"/"+board, http.StatusSeeOther)
+}
+
+func BoardPublicModLog(ctx *fiber.Ctx) error {
+	actor, err := activitypub.GetActorFromDB(config.Domain)
+
+	if err != nil {
+		return util.MakeError(err, "BoardPublicModLog")
+	}
+
+	if has := actor.HasValidation(ctx); !has {
+		return util.MakeError(err, "BoardPublicModLog")
+	}
+
+	board := ctx.Query("board")
+	_, auth := util.GetPasswordFromSession(ctx)
+
+	if actor, err = activitypub.GetActorByNameFromDB(board); err != nil {
+		return util.MakeError(err, "BoardPublicModLog")
+	}
+
+	if access, _ := util.GetStaffAccess(auth, actor.Id); access.Role != util.RoleOwner {
+		return util.MakeError(errors.New("actor does not have auth"), "BoardPublicModLog")
+	}
+
+	if err := actor.SetPublicModLog(); err != nil {
+		return util.MakeError(err, "BoardPublicModLog")
+	}
+
+	return ctx.Redirect("/"+config.Key+"/"+board, http.StatusSeeOther)
+}
+
+func BoardFlags(ctx *fiber.Ctx) error {
+	actor, err := activitypub.GetActorFromDB(config.Domain)
+
+	if err != nil {
+		return util.MakeError(err, "BoardFlags")
+	}
+
+	if has := actor.HasValidation(ctx); !has {
+		return util.MakeError(err, "BoardFlags")
+	}
+
+	board := ctx.Query("board")
+	_, auth := util.GetPasswordFromSession(ctx)
+
+	if actor, err = activitypub.GetActorByNameFromDB(board); err != nil {
+		return util.MakeError(err, "BoardFlags")
+	}
+
+	if access, _ := util.GetStaffAccess(auth, actor.Id); access.Role != util.RoleOwner {
+		return util.MakeError(errors.New("actor does not have auth"), "BoardFlags")
+	}
+
+	if err := actor.SetFlags(); err != nil {
+		return util.MakeError(err, "BoardFlags")
+	}
+
+	return ctx.Redirect("/"+config.Key+"/"+board, http.StatusSeeOther)
+}
+
+func BoardPosterIDs(ctx *fiber.Ctx) error {
+	actor, err := activitypub.GetActorFromDB(config.Domain)
+
+	if err != nil {
+		return util.MakeError(err, "BoardPosterIDs")
+	}
+
+	if has := actor.HasValidation(ctx); !has {
+		return util.MakeError(err, "BoardPosterIDs")
+	}
+
+	board := ctx.Query("board")
+	_, auth := util.GetPasswordFromSession(ctx)
+
+	if actor, err = activitypub.GetActorByNameFromDB(board); err != nil {
+		return util.MakeError(err, "BoardPosterIDs")
+	}
+
+	if access, _ := util.GetStaffAccess(auth, actor.Id); access.Role != util.RoleOwner {
+		return util.MakeError(errors.New("actor does not have auth"), "BoardPosterIDs")
+	}
+
+	if err := actor.SetPosterIDs(); err != nil {
+		return util.MakeError(err, "BoardPosterIDs")
+	}
+
+	return ctx.Redirect("/"+config.Key+"/"+board, http.StatusSeeOther)
+}
+
 func BoardBlacklist(ctx *fiber.Ctx) error {
 	actor, err := activitypub.GetActorFromDB(config.Domain)
 
@@ -440,12 +717,20 @@ func BoardBlacklist(ctx *fiber.Ctx) error {
 		return ctx.Status(404).Render("404", fiber.Map{})
 	}
 
+	if _, auth := util.GetPasswordFromSession(ctx); !util.HasPermission(auth, actor.Id, util.PermBlacklist) {
+		return util.MakeError(errors.New("actor does not have auth"), "BoardBlacklist")
+	}
+
 	if ctx.Method() == "GET" {
 		if id := ctx.Query("remove"); id != "" {
 			i, _ := strconv.Atoi(id)
 			if err := util.DeleteRegexBlacklist(i); err != nil {
 				return util.MakeError(err, "BoardBlacklist")
 			}
+
+			if err := route.LogModAction(ctx, db.ModLogEntry{Action: db.ModUnblacklist, Target: id}); err != nil {
+				return util.MakeError(err, "BoardBlacklist")
+			}
 		}
 	} else {
 		regex := ctx.FormValue("regex")
@@ -457,12 +742,12 @@ func BoardBlacklist(ctx *fiber.Ctx) error {
 
 		re := regexp.MustCompile(regex)
 
-		if testCase == "" {
+		if testCase == "" || re.MatchString(testCase) {
 			if err := util.WriteRegexBlacklist(regex); err != nil {
 				return util.MakeError(err, "BoardBlacklist")
 			}
-		} else if re.MatchString(testCase) {
-			if err := util.WriteRegexBlacklist(regex); err != nil {
+
+			if err := route.LogModAction(ctx, db.ModLogEntry{Action: db.ModBlacklist, Target: regex}); err != nil {
 				return util.MakeError(err, "BoardBlacklist")
 			}
 		}
@@ -471,6 +756,45 @@ func BoardBlacklist(ctx *fiber.Ctx) error {
 	return ctx.Redirect("/"+config.Key+"#regex", http.StatusSeeOther)
 }
 
+func BoardUnbanMedia(ctx *fiber.Ctx) error {
+	actor, err := activitypub.GetActorFromDB(config.Domain)
+
+	if err != nil {
+		return util.MakeError(err, "BoardUnbanMedia")
+	}
+
+	if has := actor.HasValidation(ctx); !has {
+		return ctx.Status(404).Render("404", fiber.Map{})
+	}
+
+	if _, auth := util.GetPasswordFromSession(ctx); !util.HasPermission(auth, actor.Id, util.PermBan) {
+		return util.MakeError(errors.New("actor does not have auth"), "BoardUnbanMedia")
+	}
+
+	if id := ctx.Query("image"); id != "" {
+		if err := db.UnbanImage(id); err != nil {
+			return util.MakeError(err, "BoardUnbanMedia")
+		}
+
+		if err := route.LogModAction(ctx, db.ModLogEntry{Action: db.ModUnbanMedia, Target: "image " + id}); err != nil {
+			return util.MakeError(err, "BoardUnbanMedia")
+		}
+	}
+
+	if id := ctx.Query("hash"); id != "" {
+		i, _ := strconv.Atoi(id)
+		if err := db.UnbanHash(i); err != nil {
+			return util.MakeError(err, "BoardUnbanMedia")
+		}
+
+		if err := route.LogModAction(ctx, db.ModLogEntry{Action: db.ModUnbanMedia, Target: "hash " + id}); err != nil {
+			return util.MakeError(err, "BoardUnbanMedia")
+		}
+	}
+
+	return ctx.Redirect("/"+config.Key+"#bannedmedia", http.StatusSeeOther)
+}
+
 func ReportPost(ctx *fiber.Ctx) error {
 	id := ctx.FormValue("id")
 	board := ctx.FormValue("board")
@@ -491,13 +815,17 @@ func ReportPost(ctx *fiber.Ctx) error {
 	var obj = activitypub.ObjectBase{Id: id}
 
 	if close == "1" {
-		if auth, err := util.HasAuth(auth, actor.Id); !auth {
-			config.Log.Println(err)
+		if has := util.HasPermission(auth, actor.Id, util.PermDelete); !has {
+			config.Log.Println("actor does not have auth")
 			return ctx.Status(404).Render("404", fiber.Map{
 				"message": "Something broke",
 			})
 		}
 
+		if err := route.LogModAction(ctx, db.ModLogEntry{Board: board, Action: db.ModCloseReport, Target: obj.Id}); err != nil {
+			return util.MakeError(err, "BoardReport")
+		}
+
 		if local, _ := obj.IsLocal(); !local {
 			if err := db.CloseLocalReport(obj.Id, board); err != nil {
 				config.Log.Println(err)
@@ -636,12 +964,16 @@ func Sticky(ctx *fiber.Ctx) error {
 	col, _ := obj.GetCollectionFromPath()
 
 	if len(col.OrderedItems) < 1 {
-		if has, _ := util.HasAuth(auth, actor.Id); !has {
+		if has := util.HasPermission(auth, actor.Id, util.PermStickyLock); !has {
 			return util.MakeError(errors.New("no auth"), "Sticky")
 		}
 
 		obj.MarkSticky(actor.Id)
 
+		if err := route.LogModAction(ctx, db.ModLogEntry{Board: board, Action: db.ModSticky, Target: id}); err != nil {
+			return util.MakeError(err, "Sticky")
+		}
+
 		return ctx.Redirect("/"+board, http.StatusSeeOther)
 	}
 
@@ -654,12 +986,16 @@ func Sticky(ctx *fiber.Ctx) error {
 		OP = id
 	}
 
-	if has, _ := util.HasAuth(auth, actor.Id); !has {
+	if has := util.HasPermission(auth, actor.Id, util.PermStickyLock); !has {
 		return util.MakeError(errors.New("no auth"), "Sticky")
 	}
 
 	obj.MarkSticky(actor.Id)
 
+	if err := route.LogModAction(ctx, db.ModLogEntry{Board: board, Action: db.ModSticky, Target: id}); err != nil {
+		return util.MakeError(err, "Sticky")
+	}
+
 	var op = activitypub.ObjectBase{Id: OP}
 	if local, _ := op.IsLocal(); !local {
 		return ctx.Redirect("/"+board+"/"+util.RemoteShort(OP), http.StatusSeeOther)
@@ -684,12 +1020,16 @@ func Lock(ctx *fiber.Ctx) error {
 	col, _ := obj.GetCollectionFromPath()
 
 	if len(col.OrderedItems) < 1 {
-		if has, _ := util.HasAuth(auth, actor.Id); !has {
+		if has := util.HasPermission(auth, actor.Id, util.PermStickyLock); !has {
 			return util.MakeError(errors.New("no auth"), "Lock")
 		}
 
 		obj.MarkLocked(actor.Id)
 
+		if err := route.LogModAction(ctx, db.ModLogEntry{Board: board, Action: db.ModLock, Target: id}); err != nil {
+			return util.MakeError(err, "Lock")
+		}
+
 		return ctx.Redirect("/"+board, http.StatusSeeOther)
 	}
 
@@ -702,12 +1042,16 @@ func Lock(ctx *fiber.Ctx) error {
 		OP = id
 	}
 
-	if has, _ := util.HasAuth(auth, actor.Id); !has {
+	if has := util.HasPermission(auth, actor.Id, util.PermStickyLock); !has {
 		return util.MakeError(errors.New("no auth"), "Lock")
 	}
 
 	obj.MarkLocked(actor.Id)
 
+	if err := route.LogModAction(ctx, db.ModLogEntry{Board: board, Action: db.ModLock, Target: id}); err != nil {
+		return util.MakeError(err, "Lock")
+	}
+
 	var op = activitypub.ObjectBase{Id: OP}
 	if local, _ := op.IsLocal(); !local {
 		return ctx.Redirect("/"+board+"/"+util.RemoteShort(OP), http.StatusSeeOther)
@@ -726,7 +1070,9 @@ func BanGet(ctx *fiber.Ctx) error {
 		return util.MakeError(errors.New("no auth"), "Ban")
 	}
 
-	if has, _ := util.HasAuth(auth, actor.Id); !has {
+	access, _ := util.GetStaffAccess(auth, actor.Id)
+
+	if !access.Can(util.PermBan) {
 		return util.MakeError(errors.New("no auth"), "Ban")
 	}
 
@@ -738,7 +1084,6 @@ func BanGet(ctx *fiber.Ctx) error {
 	// TODO: Check if IP is already permanently banned
 	// TODO: Display post content (name, comment, image (make this blurred with click through))
 	// TODO: More information like other IP's banned in this range
-	// TODO: Range bans + IPv6 prefix support
 
 	var data route.PageData
 	data.Board.Actor = actor
@@ -765,6 +1110,15 @@ func BanGet(ctx *fiber.Ctx) error {
 
 	var baninfo route.BanInfo
 	baninfo.Bans, _ = db.GetAllBansForIP(ip)
+	baninfo.Warnings, _ = db.GetAllWarningsForIP(ip)
+
+	if access.Can(util.PermViewIP) {
+		baninfo.IP = ip
+	}
+
+	if instance, _ := util.GetStaffAccess(auth, config.Domain); instance.Role == util.RoleOwner {
+		baninfo.Global = true
+	}
 
 	data.Referer = config.Domain + "/" + actor.Name
 	if strings.Contains(ctx.Get("referer"), config.Domain+"/"+actor.Name) && !strings.Contains(ctx.Get("referer"), "ban") {
@@ -786,15 +1140,35 @@ func BanPost(ctx *fiber.Ctx) error {
 		return util.MakeError(errors.New("no auth"), "Ban")
 	}
 
-	if has, _ := util.HasAuth(auth, actor.Id); !has {
+	access, _ := util.GetStaffAccess(auth, actor.Id)
+
+	if !access.Can(util.PermBan) {
 		return util.MakeError(errors.New("no auth"), "Ban")
 	}
 
-	if len(db.GetPostIP(id)) == 0 {
+	ip := db.GetPostIP(id)
+	if len(ip) == 0 {
 		return util.MakeError(errors.New("Post ID \""+ctx.Query("post")+"\" has no IP address"), "Ban")
 	}
 
 	reason := ctx.FormValue("comment")
+
+	if ctx.FormValue("action") == "Warn" {
+		if strings.TrimSpace(reason) == "" {
+			return route.Send400(ctx, "A warning needs a message")
+		}
+
+		if err := db.WarnIP(db.Warning{IP: ip, Board: board, Post: id, Message: reason}); err != nil {
+			return util.MakeError(err, "BanPost")
+		}
+
+		if err := route.LogModAction(ctx, db.ModLogEntry{Board: board, Action: db.ModWarn, Target: id, Reason: reason, IP: ip}); err != nil {
+			return util.MakeError(err, "BanPost")
+		}
+
+		return ctx.Redirect("/"+board, http.StatusSeeOther)
+	}
+
 	var expires time.Time
 	var err error
 
@@ -805,38 +1179,134 @@ func BanPost(ctx *fiber.Ctx) error {
 		if err != nil {
 			return util.MakeError(err, "BanPost")
 		}
-	} else {
-		switch expiresStr {
-		case "1day":
-			expires = time.Now().AddDate(0, 0, 1)
-		case "3days":
-			expires = time.Now().AddDate(0, 0, 3)
-		case "1week":
-			expires = time.Now().AddDate(0, 0, 7)
-		case "2weeks":
-			expires = time.Now().AddDate(0, 0, 14)
-		case "1month":
-			//expires = time.Now().AddDate(0, 1, 0)
-			expires = time.Now().AddDate(0, 0, 30)
-		case "permanent":
-			expires = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
-		default:
-			return util.MakeError(errors.New("invalid ban length"), "BanPost")
-		}
+	} else if expires, err = route.BanExpires(expiresStr); err != nil {
+		return util.MakeError(err, "BanPost")
 	}
 
 	expires = expires.UTC()
 
-	query := `INSERT INTO "bannedips" (ip, reason, date, expires) VALUES ((SELECT ip from identify WHERE id=$1 AND ip !='172.16.0.1'), $2, $3, $4);`
-	_, err = config.DB.Exec(query, id, reason, time.Now().UTC(), expires)
-	if err != nil {
+	if !access.CanBanFor(time.Until(expires)) {
+		return route.Send403(ctx, "Ban is longer than your role allows")
+	}
+
+	ban := db.Ban{Reason: reason, Expires: expires, Board: board, Post: id}
+
+	// only the instance admin bans from every board
+	if ctx.FormValue("scope") == "global" {
+		if instance, _ := util.GetStaffAccess(auth, config.Domain); instance.Role != util.RoleOwner {
+			return route.Send403(ctx, "Only the instance admin can ban from every board")
+		}
+
+		ban.Board = ""
+	}
+
+	var bits, bits6 int
+	switch ctx.FormValue("range") {
+	case "narrow":
+		bits, bits6 = 24, 64
+	case "wide":
+		bits, bits6 = 16, 48
+	}
+
+	if ban.IP, err = util.IPRange(ip, bits, bits6); err != nil {
+		return util.MakeError(err, "BanPost")
+	}
+
+	if err := db.BanIP(ban); err != nil {
+		return util.MakeError(err, "BanPost")
+	}
+
+	note := "expires " + expires.Format(time.RFC1123)
+	if ban.Board == "" {
+		note += " on every board"
+	}
+
+	if err := route.LogModAction(ctx, db.ModLogEntry{Board: board, Action: db.ModBan, Target: id, Reason: reason, Note: note, IP: ban.IP}); err != nil {
 		return util.MakeError(err, "BanPost")
 	}
 
 	// Take a little shortcut :)
 	if ctx.FormValue("banmedia") == "on" {
-		return ctx.Redirect("/banmedia?id=" + id + "&board=" + board)
+		return ctx.Redirect("/banmedia?id=" + url.QueryEscape(id) + "&board=" + board + "&note=" + url.QueryEscape(reason))
 	} else {
 		return ctx.Redirect("/"+board, http.StatusSeeOther)
 	}
 }
+
+func AppealPost(ctx *fiber.Ctx) error {
+	id, _ := strconv.Atoi(ctx.FormValue("id"))
+	status := ctx.FormValue("status")
+	response := ctx.FormValue("response")
+
+	_, auth := util.GetPasswordFromSession(ctx)
+
+	if auth == "" {
+		return util.MakeError(errors.New("no auth"), "AppealPost")
+	}
+
+	appeal, err := db.GetAppeal(id)
+
+	if err != nil {
+		return route.Send404(ctx, "Appeal not found")
+	}
+
+	if appeal.Status != db.AppealPending {
+		return route.Send400(ctx, "Appeal was already decided")
+	}
+
+	// appeals of bans on every board go to the instance admin
+	var access util.StaffAccess
+	redirect := "/" + config.Key
+
+	if appeal.Ban.Board == "" {
+		if access, _ = util.GetStaffAccess(auth, config.Domain); access.Role != util.RoleOwner {
+			return util.MakeError(errors.New("no auth"), "AppealPost")
+		}
+	} else {
+		actor, err := activitypub.GetActorByNameFromDB(appeal.Ban.Board)
+
+		if err != nil {
+			return util.MakeError(err, "AppealPost")
+		}
+
+		access, _ = util.GetStaffAccess(auth, actor.Id)
+		redirect += "/" + actor.Name
+	}
+
+	if !access.Can(util.PermBan) {
+		return util.MakeError(errors.New("no auth"), "AppealPost")
+	}
+
+	var expires time.Time
+	note := status
+
+	if status == db.AppealShortened {
+		days, err := strconv.Atoi(ctx.FormValue("days"))
+
+		if err != nil || days < 0 {
+			return route.Send400(ctx, "Shortened ban length must be a number of days")
+		}
+
+		expires = time.Now().UTC().AddDate(0, 0, days)
+
+		if !expires.Before(appeal.Ban.Expires) {
+			return route.Send400(ctx, "Shortened ban has to expire before the current one")
+		}
+
+		if !access.CanBanFor(time.Until(expires)) {
+			return route.Send403(ctx, "Ban is longer than your role allows")
+		}
+
+		note += ", expires " + expires.Format(time.RFC1123)
+	}
+
+	if err := appeal.Decide(status, response, expires); err != nil {
+		return route.Send400(ctx, "Could not decide the appeal")
+	}
+
+	if err := route.LogModAction(ctx, db.ModLogEntry{Board: appeal.Ban.Board, Action: db.ModAppeal, Target: appeal.Ban.Post, Reason: response, Note: note, IP: appeal.Ban.IP}); err != nil {
+		return util.MakeError(err, "AppealPost")
+	}
+
+	return ctx.Redirect(redirect+"#appeals", http.StatusSeeOther)
+}
@@ -38,7 +38,7 @@ func MultiDelete(ctx *fiber.Ctx) error {
 	var ban db.Ban
 	var failed int
 
-	ban.IP, ban.Reason, ban.Date, ban.Expires, _ = db.IsIPBanned(ctx.IP())
+	ban.IP, ban.Reason, ban.Date, ban.Expires, _ = db.IsIPBanned(ctx.IP(), "")
 	if len(ban.IP) > 1 {
 		return ctx.Redirect(ctx.BaseURL()+"/banned", 301)
 	}
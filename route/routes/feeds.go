@@ -48,9 +48,9 @@ func GetThreadFeed(ctx *fiber.Ctx) error {
 
 	var rows *sql.Rows
 
-	query := `select x.id, x.name, x.content, x.published, x.attributedto, x.attachment, x.preview, x.actor, x.tripcode, x.sensitive from (select id, name, content, published,
-			attributedto, attachment, preview, actor, tripcode, sensitive from activitystream where id in (select id from replies where inreplyto = $1) and type='Note' union select id, name, content, published,
-			attributedto, attachment, preview, actor, tripcode, sensitive from cacheactivitystream where id in (select id from replies where inreplyto = $1)
+	query := `select x.id, x.name, x.content, x.published, x.attributedto, x.attachment, x.preview, x.actor, x.tripcode, x.sensitive, x.posterid from (select id, name, content, published,
+			attributedto, attachment, preview, actor, tripcode, sensitive, posterid from activitystream where id in (select id from replies where inreplyto = $1) and type='Note' union select id, name, content, published,
+			attributedto, attachment, preview, actor, tripcode, sensitive, posterid from cacheactivitystream where id in (select id from replies where inreplyto = $1)
 			and type='Note') as x order by x.published desc limit $2`
 
 	if rows, err = config.DB.Query(query, thread, limit); err != nil {
@@ -59,11 +59,11 @@ func GetThreadFeed(ctx *fiber.Ctx) error {
 
 	defer rows.Close()
 	for rows.Next() {
-		var Id, Name, Content, AttributedTo, Attachment, MediaType, Preview, Actor, TripCode string
+		var Id, Name, Content, AttributedTo, Attachment, MediaType, Preview, Actor, TripCode, PosterId string
 		var Published time.Time
 		var Sensitive bool
 
-		err = rows.Scan(&Id, &Name, &Content, &Published, &AttributedTo, &Attachment, &Preview, &Actor, &TripCode, &Sensitive)
+		err = rows.Scan(&Id, &Name, &Content, &Published, &AttributedTo, &Attachment, &Preview, &Actor, &TripCode, &Sensitive, &PosterId)
 
 		if err != nil {
 			return util.MakeError(err, "GetRecentThreads")
@@ -78,9 +78,14 @@ func GetThreadFeed(ctx *fiber.Ctx) error {
 
 		}
 
+		if len(PosterId) > 0 {
+			AttributedTo = AttributedTo + " (ID: " + PosterId + ")"
+		}
+
 		if len(Content) > 0 {
-			Content = post.ParseCommentCode(Content)
-			Content = post.CloseUnclosedTags(Content)
+			obj := activitypub.ObjectBase{Id: Id, Content: Content}
+			obj.Tag, _ = obj.GetTags()
+			Content = string(post.FormatContent(obj))
 		}
 
 		if len(Preview) > 0 {
@@ -164,14 +169,14 @@ func GetBoardFeed(ctx *fiber.Ctx) error {
 	var query string
 
 	if actor.Name == "overboard" {
-		query = `select x.id, x.name, x.content, x.published, x.attributedto, x.attachment, x.preview, x.actor, x.tripcode, x.sensitive from (select id, name, content, published, 
-		attributedto, attachment, preview, actor, tripcode, sensitive from activitystream where actor in (select following from following where id in (select id from following where id=$1)) and type='Note' union select id, name, content, published, 
-		attributedto, attachment, preview, actor, tripcode, sensitive from cacheactivitystream where actor in (select following from following where id in (select id from follower where id=$1))
+		query = `select x.id, x.name, x.content, x.published, x.attributedto, x.attachment, x.preview, x.actor, x.tripcode, x.sensitive, x.posterid from (select id, name, content, published, 
+		attributedto, attachment, preview, actor, tripcode, sensitive, posterid from activitystream where actor in (select following from following where id in (select id from following where id=$1)) and type='Note' union select id, name, content, published, 
+		attributedto, attachment, preview, actor, tripcode, sensitive, posterid from cacheactivitystream where actor in (select following from following where id in (select id from follower where id=$1))
 		and type='Note') as x order by x.published desc limit $2`
 	} else {
-		query = `select x.id, x.name, x.content, x.published, x.attributedto, x.attachment, x.preview, x.actor, x.tripcode, x.sensitive from (select id, name, content, published, 
-		attributedto, attachment, preview, actor, tripcode, sensitive from activitystream where actor = $1 and type='Note' union select id, name, content, published, 
-		attributedto, attachment, preview, actor, tripcode, sensitive from cacheactivitystream where actor in (select following from following where id in (select id from follower where id=$1))
+		query = `select x.id, x.name, x.content, x.published, x.attributedto, x.attachment, x.preview, x.actor, x.tripcode, x.sensitive, x.posterid from (select id, name, content, published, 
+		attributedto, attachment, preview, actor, tripcode, sensitive, posterid from activitystream where actor = $1 and type='Note' union select id, name, content, published, 
+		attributedto, attachment, preview, actor, tripcode, sensitive, posterid from cacheactivitystream where actor in (select following from following where id in (select id from follower where id=$1))
 		and type='Note') as x order by x.published desc limit $2`
 	}
 
@@ -181,11 +186,11 @@ func GetBoardFeed(ctx *fiber.Ctx) error {
 
 	defer rows.Close()
 	for rows.Next() {
-		var Id, Name, Content, AttributedTo, Attachment, MediaType, Preview, Actor, TripCode string
+		var Id, Name, Content, AttributedTo, Attachment, MediaType, Preview, Actor, TripCode, PosterId string
 		var Published time.Time
 		var Sensitive bool
 
-		err = rows.Scan(&Id, &Name, &Content, &Published, &AttributedTo, &Attachment, &Preview, &Actor, &TripCode, &Sensitive)
+		err = rows.Scan(&Id, &Name, &Content, &Published, &AttributedTo, &Attachment, &Preview, &Actor, &TripCode, &Sensitive, &PosterId)
 
 		if err != nil {
 			return util.MakeError(err, "GetRecentThreads")
@@ -200,6 +205,10 @@ func GetBoardFeed(ctx *fiber.Ctx) error {
 
 		}
 
+		if len(PosterId) > 0 {
+			AttributedTo = AttributedTo + " (ID: " + PosterId + ")"
+		}
+
 		if len(Content) > 0 {
 			/*re := regexp.MustCompile(`((\r\n|\r|\n|^)>>(.+)?[^\r\n])`)
 			match := re.FindAllStringSubmatch(Content, -1)
@@ -207,8 +216,9 @@ func GetBoardFeed(ctx *fiber.Ctx) error {
 			for i, _ := range match {
 				Content = strings.Replace(Content, match[i][3], util.ShortURL(actor.Outbox, match[i][0]), 1)
 			}*/
-			Content = post.ParseCommentCode(Content)
-			Content = post.CloseUnclosedTags(Content)
+			obj := activitypub.ObjectBase{Id: Id, Content: Content}
+			obj.Tag, _ = obj.GetTags()
+			Content = string(post.FormatContent(obj))
 		}
 
 		if len(Preview) > 0 {
@@ -0,0 +1,61 @@
+package routes
+
+import (
+	"github.com/FChannel0/FChannel-Server/activitypub"
+	"github.com/FChannel0/FChannel-Server/config"
+	"github.com/FChannel0/FChannel-Server/db"
+	"github.com/FChannel0/FChannel-Server/route"
+	"github.com/FChannel0/FChannel-Server/util"
+	"github.com/FChannel0/FChannel-Server/webfinger"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ActorModLog shows the moderation log of a board to everyone, if the board
+// has made it public.
+func ActorModLog(ctx *fiber.Ctx) error {
+	actor, err := activitypub.GetActorByNameFromDB(ctx.Params("actor"))
+
+	if err != nil {
+		return route.Send404(ctx, "Board not found")
+	}
+
+	if public, _ := actor.GetPublicModLog(); !public {
+		return route.Send404(ctx, "This board does not have a public moderation log")
+	}
+
+	entries, err := db.GetModLog(actor.Name, ctx.Query("action"), "", 200)
+
+	if err != nil {
+		return util.MakeError(err, "ActorModLog")
+	}
+
+	var data route.PageData
+	data.Board.Name = actor.Name
+	data.Board.PrefName = actor.PreferredUsername
+	data.Board.To = actor.Outbox
+	data.Board.Actor = actor
+	data.Board.Summary = actor.Summary
+	data.Board.Domain = config.Domain
+	data.Board.Restricted = actor.Restricted
+	data.Key = config.Key
+
+	data.Instance, _ = activitypub.GetActorFromDB(config.Domain)
+
+	data.Title = "/" + actor.Name + "/ - Moderation Log"
+	data.Boards = webfinger.Boards
+
+	for _, e := range entries {
+		data.ModLog = append(data.ModLog, e.Redact())
+	}
+
+	data.Meta.Description = data.Title
+	data.Meta.Url = data.Board.Actor.Id
+	data.Meta.Title = data.Title
+
+	data.Themes = &config.Themes
+	data.ThemeCookie = route.GetThemeCookie(ctx)
+
+	return ctx.Render("modlog", fiber.Map{
+		"page": data,
+	}, "layouts/main")
+}
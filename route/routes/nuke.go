@@ -0,0 +1,245 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FChannel0/FChannel-Server/activitypub"
+	"github.com/FChannel0/FChannel-Server/config"
+	"github.com/FChannel0/FChannel-Server/db"
+	"github.com/FChannel0/FChannel-Server/post"
+	"github.com/FChannel0/FChannel-Server/route"
+	"github.com/FChannel0/FChannel-Server/util"
+	"github.com/FChannel0/FChannel-Server/webfinger"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Nuking a post removes every post made from its IP on all local boards
+// within the last hours, and can ban the IP and the media of the posts in the
+// same step. Staff only remove posts of boards they can delete on.
+
+// GetNukeInfo returns the posts made from the IP of the post id in the last
+// hours.
+func GetNukeInfo(auth string, id string, hours int) (route.NukeInfo, error) {
+	var info route.NukeInfo
+
+	info.Post = id
+	info.Hours = hours
+
+	if info.IP = db.GetPostIP(id); info.IP == "" {
+		return info, util.MakeError(errors.New("post has no IP address"), "GetNukeInfo")
+	}
+
+	posts, err := db.GetPostsByIP(info.IP, time.Now().UTC().Add(-time.Duration(hours)*time.Hour))
+
+	if err != nil {
+		return info, util.MakeError(err, "GetNukeInfo")
+	}
+
+	var boards = make(map[string]string)
+
+	for _, e := range posts {
+		if _, ok := boards[e.Actor]; !ok {
+			actor, _ := activitypub.GetActorFromDB(e.Actor)
+			boards[e.Actor] = actor.Name
+		}
+
+		info.Posts = append(info.Posts, route.NukePost{
+			Object:  e,
+			Board:   boards[e.Actor],
+			Allowed: util.HasPermission(auth, e.Actor, util.PermDelete),
+		})
+	}
+
+	if instance, _ := util.GetStaffAccess(auth, config.Domain); instance.Role == util.RoleOwner {
+		info.Global = true
+	}
+
+	return info, nil
+}
+
+func NukeGet(ctx *fiber.Ctx) error {
+	id := ctx.Query("id")
+	hours, _ := strconv.Atoi(ctx.Query("hours", "24"))
+
+	actor, err := activitypub.GetActorByNameFromDB(ctx.Query("board"))
+
+	if err != nil {
+		return util.MakeError(err, "NukeGet")
+	}
+
+	_, auth := util.GetPasswordFromSession(ctx)
+
+	if !util.HasPermission(auth, actor.Id, util.PermDelete) {
+		return util.MakeError(errors.New("no auth"), "NukeGet")
+	}
+
+	if hours < 1 || hours > 720 {
+		return route.Send400(ctx, "Time window must be between 1 and 720 hours")
+	}
+
+	info, err := GetNukeInfo(auth, id, hours)
+
+	if err != nil {
+		return route.Send400(ctx, "Post ID \""+id+"\" has no IP address")
+	}
+
+	if !util.HasPermission(auth, actor.Id, util.PermViewIP) {
+		info.IP = ""
+	}
+
+	var data route.PageData
+	data.Board.Actor = actor
+	data.Board.Name = actor.Name
+	data.Board.PrefName = actor.PreferredUsername
+	data.Board.Summary = actor.Summary
+	data.Board.Restricted = actor.Restricted
+
+	data.Meta.Description = data.Board.Summary
+	data.Meta.Url = data.Board.Actor.Id
+	data.Meta.Title = data.Title
+
+	data.Instance, _ = activitypub.GetActorFromDB(config.Domain)
+
+	data.Themes = &config.Themes
+	data.ThemeCookie = route.GetThemeCookie(ctx)
+
+	data.Key = config.Key
+	data.Board.ModCred, _ = util.GetPasswordFromSession(ctx)
+	data.Board.Domain = config.Domain
+	data.Boards = webfinger.Boards
+
+	return ctx.Render("nuke", fiber.Map{"page": data, "nuke": info}, "layouts/main")
+}
+
+func NukePost(ctx *fiber.Ctx) error {
+	id := ctx.FormValue("id")
+	board := ctx.FormValue("board")
+	reason := ctx.FormValue("reason")
+	hours, _ := strconv.Atoi(ctx.FormValue("hours"))
+
+	actor, err := activitypub.GetActorByNameFromDB(board)
+
+	if err != nil {
+		return util.MakeError(err, "NukePost")
+	}
+
+	_, auth := util.GetPasswordFromSession(ctx)
+
+	if !util.HasPermission(auth, actor.Id, util.PermDelete) {
+		return util.MakeError(errors.New("no auth"), "NukePost")
+	}
+
+	if hours < 1 || hours > 720 {
+		return route.Send400(ctx, "Time window must be between 1 and 720 hours")
+	}
+
+	info, err := GetNukeInfo(auth, id, hours)
+
+	if err != nil {
+		return route.Send400(ctx, "Post ID \""+id+"\" has no IP address")
+	}
+
+	var expires time.Time
+	ban := ctx.FormValue("ban") == "on"
+
+	if ban {
+		if expires, err = route.BanExpires(ctx.FormValue("expires")); err != nil {
+			return route.Send400(ctx, "Invalid ban length")
+		}
+	}
+
+	var deleted int
+	var nuked = make(map[string]bool)
+	var boards = make(map[string]string)
+
+	for _, e := range info.Posts {
+		if !e.Allowed {
+			continue
+		}
+
+		obj := e.Object
+		boards[obj.Actor] = e.Board
+
+		// replies were removed with their thread
+		if len(obj.InReplyTo) > 0 && nuked[obj.InReplyTo[0].Id] {
+			continue
+		}
+
+		if ctx.FormValue("banmedia") == "on" && len(obj.Attachment) > 0 && obj.Attachment[0].Href != "" && util.HasPermission(auth, obj.Actor, util.PermBan) {
+			if err := post.BanMedia(obj.Attachment[0].Href, reason); err != nil {
+				config.Log.Println(err)
+			}
+		}
+
+		if isOP, _ := obj.CheckIfOP(); isOP {
+			if err := obj.TombstoneReplies(); err != nil {
+				return util.MakeError(err, "NukePost")
+			}
+		} else if err := obj.Tombstone(); err != nil {
+			return util.MakeError(err, "NukePost")
+		}
+
+		if local, _ := obj.IsLocal(); local {
+			if err := obj.DeleteRequest(); err != nil {
+				return util.MakeError(err, "NukePost")
+			}
+		}
+
+		nuked[obj.Id] = true
+		deleted++
+	}
+
+	var names []string
+
+	for k, e := range boards {
+		if err := (activitypub.Actor{Id: k}).UnArchiveLast(); err != nil {
+			return util.MakeError(err, "NukePost")
+		}
+
+		names = append(names, "/"+e+"/")
+	}
+
+	sort.Strings(names)
+
+	if ban {
+		var bans []db.Ban
+
+		// one ban on every board, or a ban on each nuked board the staff
+		// member can ban on
+		if ctx.FormValue("scope") == "global" && info.Global {
+			bans = append(bans, db.Ban{IP: info.IP, Reason: reason, Expires: expires, Post: id})
+		} else {
+			if _, ok := boards[actor.Id]; !ok {
+				boards[actor.Id] = actor.Name
+			}
+
+			for k, e := range boards {
+				if access, _ := util.GetStaffAccess(auth, k); access.CanBanFor(time.Until(expires)) {
+					bans = append(bans, db.Ban{IP: info.IP, Board: e, Reason: reason, Expires: expires, Post: id})
+				}
+			}
+		}
+
+		for _, e := range bans {
+			if err := db.BanIP(e); err != nil {
+				return util.MakeError(err, "NukePost")
+			}
+		}
+	}
+
+	note := strconv.Itoa(deleted) + " posts deleted"
+	if len(names) > 0 {
+		note += " on " + strings.Join(names, ", ")
+	}
+
+	if err := route.LogModAction(ctx, db.ModLogEntry{Board: board, Action: db.ModNuke, Target: id, Reason: reason, Note: note, IP: info.IP}); err != nil {
+		return util.MakeError(err, "NukePost")
+	}
+
+	return ctx.Redirect("/"+board, http.StatusSeeOther)
+}
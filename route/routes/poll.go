@@ -0,0 +1,71 @@
+package routes
+
+import (
+	"net/url"
+
+	"github.com/FChannel0/FChannel-Server/activitypub"
+	"github.com/FChannel0/FChannel-Server/config"
+	"github.com/FChannel0/FChannel-Server/db"
+	"github.com/FChannel0/FChannel-Server/post"
+	"github.com/FChannel0/FChannel-Server/route"
+	"github.com/FChannel0/FChannel-Server/util"
+	"github.com/gofiber/fiber/v2"
+)
+
+func PollVote(ctx *fiber.Ctx) error {
+	values, err := url.ParseQuery(string(ctx.Body()))
+	if err != nil {
+		return util.MakeError(err, "PollVote")
+	}
+
+	obj := activitypub.ObjectBase{Id: values.Get("id")}
+
+	board, err := obj.GetPollBoard()
+	if err != nil {
+		config.Log.Println(err)
+		return route.Send400(ctx, "Vote could not be counted, the poll may be closed")
+	}
+
+	// bans are checked against the board of the poll
+	var ban db.Ban
+
+	ban.IP, ban.Reason, ban.Date, ban.Expires, _ = db.IsIPBanned(ctx.IP(), board.Name)
+	if len(ban.IP) > 1 {
+		return ctx.Redirect(ctx.BaseURL()+"/banned", 301)
+	}
+	choices := values["choice:"+obj.Id]
+	voter := post.VoterHash(ctx.IP(), obj.Id)
+
+	if voted, err := obj.HasVoted(voter); err != nil {
+		return util.MakeError(err, "PollVote")
+	} else if voted {
+		return route.Send400(ctx, "You have already voted in this poll")
+	}
+
+	if err := obj.Vote(voter, choices); err != nil {
+		config.Log.Println(err)
+		return route.Send400(ctx, "Vote could not be counted, the poll may be closed")
+	}
+
+	// votes on remote polls are counted by the instance of the poll, which
+	// sends the new counts back
+	if local, _ := obj.IsLocal(); local {
+		go func() {
+			if err := obj.SendPollUpdate(); err != nil {
+				config.Log.Println(err)
+			}
+		}()
+	} else {
+		actor, err := activitypub.GetActorFromDB(config.Domain)
+
+		if err != nil {
+			return util.MakeError(err, "PollVote")
+		}
+
+		if err := obj.SendVote(actor, choices); err != nil {
+			return util.MakeError(err, "PollVote")
+		}
+	}
+
+	return ctx.RedirectBack("/")
+}
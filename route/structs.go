@@ -24,6 +24,7 @@ type PageData struct {
 	BoardRemainer     []int
 	Meta              Meta
 	PostType          string
+	ModLog            []db.ModLogEntry
 
 	Themes      *[]string
 	ThemeCookie string
@@ -32,20 +33,45 @@ type PageData struct {
 }
 
 type AdminPage struct {
-	Title         string
-	Board         webfinger.Board
-	Key           string
-	Actor         string
-	Boards        []webfinger.Board
-	Following     []string
-	Followers     []string
-	Domain        string
-	IsLocal       bool
-	PostBlacklist []util.PostBlacklist
-	AutoSubscribe bool
-	RecentPosts   []activitypub.ObjectBase
-	Instance      activitypub.Actor
-	Meta          Meta
+	Title             string
+	Board             webfinger.Board
+	Key               string
+	Actor             string
+	Boards            []webfinger.Board
+	Following         []string
+	Followers         []string
+	Domain            string
+	IsLocal           bool
+	PostBlacklist     []util.PostBlacklist
+	BannedImages      []db.BannedImage
+	BannedHashes      []db.BannedHash
+	AutoSubscribe     bool
+	PosterIDs         bool
+	Flags             bool
+	Dice              bool
+	R9K               bool
+	Filters           []db.BoardFilter
+	FilterTest        string
+	FilterTestResult  string
+	FilterTestMatches []db.BoardFilter
+	ThreadCooldown    int
+	ReplyCooldown     int
+	DuplicateCooldown int
+	SpamHold          int
+	SpamReject        int
+	Premoderation     string
+	Pending           []activitypub.PendingPost
+	PublicModLog      bool
+	ModLog            []db.ModLogEntry
+	ModLogActions     []string
+	ModLogAction      string
+	ModLogStaff       string
+	Appeals           []db.Appeal
+	Staff             util.StaffAccess
+	Permissions       []string
+	RecentPosts       []activitypub.ObjectBase
+	Instance          activitypub.Actor
+	Meta              Meta
 
 	Themes      *[]string
 	ThemeCookie string
@@ -59,10 +85,31 @@ type Meta struct {
 }
 
 type BanInfo struct {
-	Bans []db.Ban
+	Bans     []db.Ban
+	Warnings []db.Warning
+	// IP of the post, only set for staff allowed to see it
+	IP string
+	// whether the ban can be for every board
+	Global bool
 	//Post         activitypub.ObjectBase
 }
 
+type NukeInfo struct {
+	Post  string
+	IP    string
+	Hours int
+	Posts []NukePost
+	// whether the ban can be for every board
+	Global bool
+}
+
+type NukePost struct {
+	Object activitypub.ObjectBase
+	Board  string
+	// whether the staff member can delete the post
+	Allowed bool
+}
+
 type errorData struct {
 	Message string
 	Error   error
@@ -6,6 +6,7 @@ import (
 	"encoding/base64"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"math/rand"
@@ -102,6 +103,36 @@ func GetActorPost(ctx *fiber.Ctx, path string) error {
 	return nil
 }
 
+// BanExpires returns when a ban of one of the lengths offered on the ban form
+// expires.
+func BanExpires(length string) (time.Time, error) {
+	switch length {
+	case "1day":
+		return time.Now().UTC().AddDate(0, 0, 1), nil
+	case "3days":
+		return time.Now().UTC().AddDate(0, 0, 3), nil
+	case "1week":
+		return time.Now().UTC().AddDate(0, 0, 7), nil
+	case "2weeks":
+		return time.Now().UTC().AddDate(0, 0, 14), nil
+	case "1month":
+		return time.Now().UTC().AddDate(0, 0, 30), nil
+	case "permanent":
+		return time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC), nil
+	}
+
+	return time.Time{}, util.MakeError(errors.New("invalid ban length"), "BanExpires")
+}
+
+// LogModAction adds entry to the moderation log as done by the staff member
+// signed in on ctx.
+func LogModAction(ctx *fiber.Ctx, entry db.ModLogEntry) error {
+	_, code := util.GetPasswordFromSession(ctx)
+	entry.Identifier, entry.Label = db.GetModLogStaff(code)
+
+	return util.MakeError(db.WriteModLog(entry), "LogModAction")
+}
+
 func ParseOutboxRequest(ctx *fiber.Ctx, actor activitypub.Actor) error {
 	contentType := util.GetContentType(ctx.Get("content-type"))
 
@@ -113,6 +144,53 @@ func ParseOutboxRequest(ctx *fiber.Ctx, actor activitypub.Actor) error {
 
 		valid, err := post.CheckCaptcha(ctx.FormValue("captcha"))
 		if err == nil && hasCaptcha && valid {
+			if ip := ctx.Get("PosterIP"); ip != "" {
+				if banned, _, _, _, _ := db.IsIPBanned(ip, actor.Name); len(banned) > 1 {
+					ctx.Response().Header.SetStatusCode(403)
+					_, err := ctx.Write([]byte("You are banned from posting on /" + actor.Name + "/"))
+					return util.MakeError(err, "ParseOutboxRequest")
+				}
+			}
+
+			posters := post.CooldownPosters(ctx)
+			reply := ctx.FormValue("inReplyTo") != ""
+
+			if left, _type, err := post.GetCooldown(actor, posters, reply, ctx.FormValue("comment")); err != nil {
+				return util.MakeError(err, "ParseOutboxRequest")
+			} else if left > 0 {
+				ctx.Response().Header.SetStatusCode(403)
+				_, err := ctx.Write([]byte(post.CooldownMessage(left, _type)))
+				return util.MakeError(err, "ParseOutboxRequest")
+			}
+
+			r9k, _ := actor.GetR9K()
+
+			hashes, err := post.OriginalityHashes(ctx, r9k)
+			if err != nil {
+				return util.MakeError(err, "ParseOutboxRequest")
+			}
+
+			if r9k {
+				if original, err := actor.IsOriginal(hashes); err != nil {
+					return util.MakeError(err, "ParseOutboxRequest")
+				} else if !original {
+					message := "Your post is not original"
+
+					if ip := ctx.Get("PosterIP"); ip != "" && ip != "172.16.0.1" {
+						expires, err := db.R9KMute(ip, actor.Name)
+						if err != nil {
+							return util.MakeError(err, "ParseOutboxRequest")
+						}
+
+						message += ", you are muted until " + expires.Format("01/02/06(Mon)15:04:05") + " UTC"
+					}
+
+					ctx.Response().Header.SetStatusCode(403)
+					_, err := ctx.Write([]byte(message))
+					return util.MakeError(err, "ParseOutboxRequest")
+				}
+			}
+
 			header, _ := ctx.FormFile("file")
 			if header != nil {
 				f, _ := header.Open()
@@ -145,11 +223,31 @@ func ParseOutboxRequest(ctx *fiber.Ctx, actor activitypub.Actor) error {
 			}
 
 			var nObj = activitypub.CreateObject("Note")
-			nObj, err := post.ObjectFromForm(ctx, nObj)
+			nObj, err = post.ObjectFromForm(ctx, nObj)
+
+			// the upload holds a reference to the stored file until the post is
+			// written with its own, it is removed if the post is turned away
+			defer func() {
+				if len(nObj.Attachment) > 0 && nObj.Attachment[0].Href != "" {
+					if _, err := activitypub.ReleaseMedia(nObj.Attachment[0].Href); err != nil {
+						config.Log.Println(err)
+					}
+				}
+			}()
+
 			if err != nil {
 				return util.MakeError(err, "ParseOutboxRequest")
 			}
 
+			// the file was not hashed above, its stored name is its hash
+			if !r9k {
+				for _, e := range nObj.Attachment {
+					if e.Href != "" {
+						hashes = append(hashes, "media:"+activitypub.MediaHash(e.Href))
+					}
+				}
+			}
+
 			op := len(nObj.InReplyTo) - 1
 			if op >= 0 {
 				if nObj.InReplyTo[op].Id == "" {
@@ -181,38 +279,181 @@ func ParseOutboxRequest(ctx *fiber.Ctx, actor activitypub.Actor) error {
 
 			nObj.Actor = config.Domain + "/" + actor.Name
 
+			if dice, _ := actor.GetDice(); dice {
+				rolls, err := post.RollOptions(nObj.Option)
+				if err != nil {
+					return util.MakeError(err, "ParseOutboxRequest")
+				}
+
+				nObj.Tag = append(nObj.Tag, rolls...)
+			}
+
+			// capcodes are only allowed for staff of the board posting with their session
+			if post.IsCapcode(nObj.TripCode) {
+				_, modcred := util.GetPasswordFromSession(ctx)
+				if hasAuth, level := util.HasAuth(modcred, actor.Id); !hasAuth || !post.CapcodeAllowed(nObj.TripCode, level) {
+					nObj.TripCode = ""
+				}
+			} else if strings.HasPrefix(nObj.TripCode, "#") {
+				nObj.TripCode = ""
+			}
+
+			if flags, _ := actor.GetFlags(); flags {
+				nObj.Tag = append(nObj.Tag, activitypub.ObjectBase{Type: activitypub.FlagType, Name: util.GetCC(ctx.Get("PosterIP"))})
+			}
+
+			nObj, filter, err := post.FilterPost(actor, nObj, ctx.FormValue("subject"), ctx.FormValue("comment"))
+			if err != nil {
+				return util.MakeError(err, "ParseOutboxRequest")
+			}
+
+			switch filter.Action {
+			case db.FilterReject, db.FilterBan:
+				message := filter.Message
+
+				if filter.Action == db.FilterBan {
+					if message == "" {
+						message = "Post matched a board filter"
+					}
+
+					if ip := ctx.Get("PosterIP"); ip != "" && ip != "172.16.0.1" {
+						expires := time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+						if filter.Duration > 0 {
+							expires = time.Now().UTC().Add(time.Duration(filter.Duration) * time.Second)
+						}
+
+						if err := db.BanIP(db.Ban{IP: ip, Board: actor.Name, Reason: message, Expires: expires}); err != nil {
+							return util.MakeError(err, "ParseOutboxRequest")
+						}
+					}
+
+					message = "You have been banned: " + message
+				} else if message == "" {
+					message = "Your post was rejected by a board filter"
+				}
+
+				ctx.Response().Header.SetStatusCode(403)
+				_, err := ctx.Write([]byte(message))
+				return util.MakeError(err, "ParseOutboxRequest")
+			case db.FilterDrop:
+				ctx.Response().Header.Set("Status", "200")
+				_, err := ctx.Write([]byte(""))
+				return util.MakeError(err, "ParseOutboxRequest")
+			}
+
+			spam, reasons, err := post.CheckSpam(post.SpamPost{Actor: actor, Object: nObj, Hashes: hashes, IP: ctx.Get("PosterIP")})
+			if err != nil {
+				return util.MakeError(err, "ParseOutboxRequest")
+			}
+
+			if spam == activitypub.SpamReject {
+				ctx.Response().Header.SetStatusCode(403)
+				_, err := ctx.Write([]byte("Your post was rejected as spam: " + strings.Join(reasons, ", ")))
+				return util.MakeError(err, "ParseOutboxRequest")
+			}
+
 			if locked, _ := nObj.InReplyTo[0].IsLocked(); locked {
 				ctx.Response().Header.SetStatusCode(403)
 				_, err := ctx.Write([]byte("thread is locked"))
 				return util.MakeError(err, "ParseOutboxRequest")
 			}
 
+			if pending, _ := nObj.InReplyTo[0].IsPending(); pending {
+				ctx.Response().Header.SetStatusCode(403)
+				_, err := ctx.Write([]byte("thread is awaiting approval"))
+				return util.MakeError(err, "ParseOutboxRequest")
+			}
+
+			if approval, _ := actor.NeedsApproval(nObj); approval {
+				spam = activitypub.SpamHold
+			}
+
+			if spam == activitypub.SpamHold {
+				nObj.Type = activitypub.PendingType
+			}
+
 			nObj, err = nObj.Write()
 			if err != nil {
 				return util.MakeError(err, "ParseOutboxRequest")
 			}
 
-			if len(nObj.To) == 0 {
-				if err := actor.ArchivePosts(); err != nil {
+			if post.IsCapcode(nObj.TripCode) {
+				tag, err := nObj.SignCapcode(actor)
+				if err != nil {
+					return util.MakeError(err, "ParseOutboxRequest")
+				}
+
+				nObj.Tag = append(nObj.Tag, tag)
+				if err := nObj.WriteTags(); err != nil {
 					return util.MakeError(err, "ParseOutboxRequest")
 				}
 			}
 
-			go func(nObj activitypub.ObjectBase) {
-				activity, err := nObj.CreateActivity("Create")
-				if err != nil {
-					config.Log.Printf("ParseOutboxRequest Create Activity: %s", err)
+			if posterIDs, _ := actor.GetPosterIDs(); posterIDs {
+				thread := nObj.Id
+				if nObj.InReplyTo[0].Id != "" {
+					thread = nObj.InReplyTo[0].Id
 				}
 
-				activity, err = activity.AddFollowersTo()
-				if err != nil {
-					config.Log.Printf("ParseOutboxRequest Add FollowersTo: %s", err)
+				nObj.PosterId = post.CreatePosterID(ctx.Get("PosterIP"), thread)
+				if err := nObj.UpdatePosterId(); err != nil {
+					return util.MakeError(err, "ParseOutboxRequest")
 				}
+			}
 
-				if err := activity.MakeRequestInbox(); err != nil {
-					config.Log.Printf("ParseOutboxRequest MakeRequestInbox: %s", err)
+			if err := post.WriteCooldowns(actor, posters, reply, ctx.FormValue("comment")); err != nil {
+				return util.MakeError(err, "ParseOutboxRequest")
+			}
+
+			if err := actor.WriteOriginality(hashes); err != nil {
+				return util.MakeError(err, "ParseOutboxRequest")
+			}
+
+			if nObj.Type == activitypub.PendingType {
+				if err := actor.HoldForReview(nObj, reasons); err != nil {
+					return util.MakeError(err, "ParseOutboxRequest")
+				}
+			}
+
+			if filter.Action == db.FilterReport {
+				reason := filter.Message
+				if reason == "" {
+					reason = "Matched filter " + filter.Regex
 				}
-			}(nObj)
+
+				if r := []rune(reason); len(r) > 100 {
+					reason = string(r[:100])
+				}
+
+				if err := db.CreateLocalReport(nObj.Id, actor.Name, reason); err != nil {
+					return util.MakeError(err, "ParseOutboxRequest")
+				}
+			}
+
+			if len(nObj.To) == 0 && nObj.Type != activitypub.PendingType {
+				if err := actor.ArchivePosts(); err != nil {
+					return util.MakeError(err, "ParseOutboxRequest")
+				}
+			}
+
+			// held posts are sent to followers once approved
+			if nObj.Type != activitypub.PendingType {
+				go func(nObj activitypub.ObjectBase) {
+					activity, err := nObj.CreateActivity("Create")
+					if err != nil {
+						config.Log.Printf("ParseOutboxRequest Create Activity: %s", err)
+					}
+
+					activity, err = activity.AddFollowersTo()
+					if err != nil {
+						config.Log.Printf("ParseOutboxRequest Add FollowersTo: %s", err)
+					}
+
+					if err := activity.MakeRequestInbox(); err != nil {
+						config.Log.Printf("ParseOutboxRequest MakeRequestInbox: %s", err)
+					}
+				}(nObj)
+			}
 
 			go func(obj activitypub.ObjectBase) {
 				err := obj.SendEmailNotify()
@@ -243,6 +484,12 @@ func ParseOutboxRequest(ctx *fiber.Ctx, actor activitypub.Actor) error {
 				}
 			}
 
+			if nObj.Type == activitypub.PendingType {
+				ctx.Response().Header.SetStatusCode(202)
+				_, err = ctx.Write([]byte("Your post is awaiting approval"))
+				return util.MakeError(err, "ParseOutboxRequest")
+			}
+
 			ctx.Response().Header.Set("Status", "200")
 			_, err = ctx.Write([]byte(id))
 			return util.MakeError(err, "ParseOutboxRequest")
@@ -427,6 +674,12 @@ func TemplateFunctions(engine *html.Engine) {
 
 	engine.AddFunc("parseAttachment", post.ParseAttachment)
 
+	engine.AddFunc("sensitivePreview", post.SensitivePreview)
+
+	engine.AddFunc("mediaSize", func(attachment activitypub.ObjectBase, max int) template.CSS {
+		return template.CSS(post.MediaSize(attachment, max))
+	})
+
 	engine.AddFunc("parseContent", post.ParseContent)
 
 	engine.AddFunc("formatContent", post.FormatContent)
@@ -439,11 +692,36 @@ func TemplateFunctions(engine *html.Engine) {
 
 	engine.AddFunc("parseReplyLink", func(actorId string, op string, id string, content string) template.HTML {
 		actor, _ := activitypub.FingerActor(actorId)
-		title := strings.ReplaceAll(post.ParseLinkTitle(actor.Id+"/", op, content), `/\&lt;`, ">")
+		title := template.HTMLEscapeString(post.ParseLinkTitle(actor.Id+"/", op, content))
 		link := "<a href=\"/" + actor.Name + "/" + util.ShortURL(actor.Outbox, op) + "#" + util.ShortURL(actor.Outbox, id) + "\" title=\"" + title + "\" class=\"replyLink\">&gt;&gt;" + util.ShortURL(actor.Outbox, id) + "</a>"
 		return template.HTML(link)
 	})
 
+	engine.AddFunc("parseBacklink", func(actor activitypub.Actor, op string, backlink activitypub.ObjectBase) template.HTML {
+		var replyOP string
+
+		if len(backlink.InReplyTo) > 0 {
+			replyOP = backlink.InReplyTo[0].Id
+		}
+
+		if replyOP == "" || replyOP == op {
+			title := template.HTMLEscapeString(post.ParseLinkTitle(actor.Id+"/", op, backlink.Content))
+			link := "<a href=\"/" + actor.Name + "/" + util.ShortURL(actor.Outbox, op) + "#" + util.ShortURL(actor.Outbox, backlink.Id) + "\" title=\"" + title + "\" class=\"replyLink\">&gt;&gt;" + util.ShortURL(actor.Outbox, backlink.Id) + "</a>"
+			return template.HTML(link)
+		}
+
+		// quoted from another thread, link to the post in its own thread
+		href := replyOP + "#" + util.ShortURL(replyOP, backlink.Id)
+
+		if strings.HasPrefix(href, config.Domain+"/") {
+			href = strings.TrimPrefix(href, config.Domain)
+		}
+
+		title := template.HTMLEscapeString(post.ParseLinkTitle(replyOP, replyOP, backlink.Content))
+		link := "<a href=\"" + template.HTMLEscapeString(href) + "\" title=\"" + title + "\" class=\"replyLink\">&gt;&gt;" + template.HTMLEscapeString(util.ShortURL(replyOP, backlink.Id)) + " (Cross-thread)</a>"
+		return template.HTML(link)
+	})
+
 	engine.AddFunc("shortExcerpt", func(post activitypub.ObjectBase) template.HTML {
 		var returnString string
 
@@ -477,10 +755,7 @@ func TemplateFunctions(engine *html.Engine) {
 	})
 
 	engine.AddFunc("parseLinkTitle", func(board string, op string, content string) string {
-		nContent := post.ParseLinkTitle(board, op, content)
-		nContent = strings.ReplaceAll(nContent, `/\&lt;`, ">")
-
-		return nContent
+		return post.ParseLinkTitle(board, op, content)
 	})
 
 	engine.AddFunc("parseLink", func(board activitypub.Actor, link string) string {
@@ -515,50 +790,90 @@ func TemplateFunctions(engine *html.Engine) {
 		cc := re.FindString(input)
 
 		if id != "" {
-			var r, g, b int
-			var txtcol, bgcol string
-			//var shadcol string
-			id = strings.TrimPrefix(id, "id:")
-			if id == "HiddenID" {
-				bgcol = "rgb(255, 255, 255)"
-				txtcol = "#000"
-			} else {
-				h := md5.New()
-				h.Write([]byte(id))
-				var seed uint64 = binary.BigEndian.Uint64(h.Sum(nil))
-				rand.Seed(int64(seed))
-				r = rand.Intn(256)
-				g = rand.Intn(256)
-				b = rand.Intn(256)
-				bgcol = "rgb(" + strconv.Itoa(r) + ", " + strconv.Itoa(g) + ", " + strconv.Itoa(b) + ")"
-				var l float64 = ((0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 255)
-				if l > 0.5 {
-					txtcol = "#000"
-				} else {
-					txtcol = "#FFF"
-				}
-			}
-			html = " <span class=\"posteruid id_" + id + "\">(ID: <span class=\"id\" style=\"background-color: " + bgcol + "; color: " + txtcol + ";\">" + id + "</span>)</span>"
+			html = PosterIDHTML(strings.TrimPrefix(id, "id:"))
 		}
 		if cc != "" {
-			var countryname string
-			cc = strings.TrimPrefix(cc, "cc:")
-			//TODO: remove external library for country
-			switch cc {
-			case "xp":
-				countryname = "Tor/Proxy"
-			default:
-				if posterCountry, ok := country.ByAlpha2CodeStr(cc); ok {
-					countryname = posterCountry.Name().String()
-				} else {
-					countryname = "Unknown/Hidden"
-				}
+			html = html + CountryFlagHTML(strings.TrimPrefix(cc, "cc:"))
+		}
+		return template.HTML(html)
+	})
+
+	engine.AddFunc("postFlag", func(obj activitypub.ObjectBase) template.HTML {
+		if cc := obj.GetFlag(); cc != "" {
+			return template.HTML(CountryFlagHTML(cc))
+		}
+
+		return ""
+	})
+
+	engine.AddFunc("postRolls", func(obj activitypub.ObjectBase) template.HTML {
+		var html string
+
+		for _, e := range obj.Tag {
+			switch e.Type {
+			case activitypub.DiceType:
+				html += "<span class=\"roll\">Rolled " + template.HTMLEscapeString(e.Name) + ": " + template.HTMLEscapeString(e.Content) + "</span>"
+			case activitypub.FortuneType:
+				html += "<span class=\"fortune\">Your fortune: " + template.HTMLEscapeString(e.Content) + "</span>"
 			}
-			html = html + " <span title=\"" + countryname + "\" class=\"flag flag-" + cc + "\"></span>"
 		}
+
 		return template.HTML(html)
 	})
 
+	engine.AddFunc("postPoll", func(obj activitypub.ObjectBase) template.HTML {
+		choices := obj.PollChoices()
+
+		if len(choices) == 0 {
+			return ""
+		}
+
+		input := "radio"
+		if len(obj.AnyOf) > 0 {
+			input = "checkbox"
+		}
+
+		// votes on remote polls have to be made on the instance of the poll
+		open := obj.Closed == "" && strings.HasPrefix(obj.Id, config.Domain+"/")
+		id := template.HTMLEscapeString(obj.Id)
+
+		// posts are in the delete form, the inputs belong to the vote form
+		// of the page instead
+		html := "<span class=\"poll\">"
+
+		for _, e := range choices {
+			name := template.HTMLEscapeString(e.Name)
+
+			html += "<label>"
+			if open {
+				html += "<input type=\"" + input + "\" form=\"vote\" name=\"choice:" + id + "\" value=\"" + name + "\"> "
+			}
+			html += name + " <span class=\"poll-votes\">(" + strconv.Itoa(e.Replies.TotalItems) + ")</span></label><br>"
+		}
+
+		html += "<small>" + strconv.Itoa(obj.VotersCount) + " voters"
+
+		if t, err := time.Parse(time.RFC3339, obj.EndTime); err == nil {
+			if obj.Closed != "" {
+				html += ", closed " + t.Format("01/02/06(Mon)15:04:05")
+			} else {
+				html += ", closes " + t.Format("01/02/06(Mon)15:04:05")
+			}
+		}
+
+		html += "</small>"
+
+		if open {
+			html += " <button type=\"submit\" form=\"vote\" name=\"id\" value=\"" + id + "\">Vote</button>"
+		}
+
+		return template.HTML(html + "</span>")
+	})
+
+	engine.AddFunc("parsePosterID", func(id string) template.HTML {
+		return template.HTML(PosterIDHTML(template.HTMLEscapeString(id)))
+	})
+
 	engine.AddFunc("parseEmail", func(input string) template.HTML {
 		var html string
 		if len(input) > 1 {
@@ -685,6 +1000,24 @@ func GenericError(ctx *fiber.Ctx, msg ...string) error {
 	}, "layouts/main")
 }
 
+// SendMessage shows msg to the user on a page of its own.
+func SendMessage(ctx *fiber.Ctx, msg string) error {
+	var data PageData
+	var errorData errorData
+
+	data.Boards = webfinger.Boards
+	data.Themes = &config.Themes
+	data.ThemeCookie = GetThemeCookie(ctx)
+	data.Referer = ctx.Get("referer")
+
+	errorData.Message = msg
+
+	return ctx.Render("gerror", fiber.Map{
+		"page":  data,
+		"error": errorData,
+	}, "layouts/main")
+}
+
 func Send500(ctx *fiber.Ctx, err error, msg ...string) error {
 
 	var m string
@@ -715,3 +1048,51 @@ func Send500(ctx *fiber.Ctx, err error, msg ...string) error {
 var Send400 = StatusTemplate(400)
 var Send403 = StatusTemplate(403)
 var Send404 = StatusTemplate(404)
+
+// PosterIDHTML returns the html for the poster id, shown on a background
+// colour derived from it.
+func PosterIDHTML(id string) string {
+	var r, g, b int
+	var txtcol, bgcol string
+
+	if id == post.HiddenPosterID {
+		bgcol = "rgb(255, 255, 255)"
+		txtcol = "#000"
+	} else {
+		h := md5.New()
+		h.Write([]byte(id))
+		var seed uint64 = binary.BigEndian.Uint64(h.Sum(nil))
+		rand.Seed(int64(seed))
+		r = rand.Intn(256)
+		g = rand.Intn(256)
+		b = rand.Intn(256)
+		bgcol = "rgb(" + strconv.Itoa(r) + ", " + strconv.Itoa(g) + ", " + strconv.Itoa(b) + ")"
+		var l float64 = ((0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 255)
+		if l > 0.5 {
+			txtcol = "#000"
+		} else {
+			txtcol = "#FFF"
+		}
+	}
+
+	return " <span class=\"posteruid id_" + id + "\">(ID: <span class=\"id\" style=\"background-color: " + bgcol + "; color: " + txtcol + ";\">" + id + "</span>)</span>"
+}
+
+// CountryFlagHTML returns the html for the flag of the country code cc.
+func CountryFlagHTML(cc string) string {
+	var countryname string
+
+	//TODO: remove external library for country
+	switch cc {
+	case "xp":
+		countryname = "Tor/Proxy"
+	default:
+		if posterCountry, ok := country.ByAlpha2CodeStr(cc); ok {
+			countryname = posterCountry.Name().String()
+		} else {
+			countryname = "Unknown/Hidden"
+		}
+	}
+
+	return " <span title=\"" + countryname + "\" class=\"flag flag-" + cc + "\"></span>"
+}
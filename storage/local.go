@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/FChannel0/FChannel-Server/util"
+)
+
+// Local stores media on disk, it is served by the /public static route.
+type Local struct {
+	Dir string
+}
+
+func (l Local) path(name string) string {
+	return filepath.Join(l.Dir, filepath.Base(name))
+}
+
+func (l Local) Put(name string, path string, mediatype string) error {
+	dst := l.path(name)
+
+	if filepath.Clean(path) == dst {
+		return nil
+	}
+
+	src, err := os.Open(path)
+
+	if err != nil {
+		return util.MakeError(err, "Put")
+	}
+
+	defer src.Close()
+
+	out, err := os.Create(dst)
+
+	if err != nil {
+		return util.MakeError(err, "Put")
+	}
+
+	defer out.Close()
+
+	_, err = io.Copy(out, src)
+	return util.MakeError(err, "Put")
+}
+
+func (l Local) Open(name string) (File, error) {
+	f, err := os.Open(l.path(name))
+
+	if err != nil {
+		return nil, util.MakeError(err, "Open")
+	}
+
+	return f, nil
+}
+
+func (l Local) Delete(name string) error {
+	if err := os.Remove(l.path(name)); err != nil && !os.IsNotExist(err) {
+		return util.MakeError(err, "Delete")
+	}
+
+	return nil
+}
+
+func (l Local) Exists(name string) (bool, error) {
+	if _, err := os.Stat(l.path(name)); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, util.MakeError(err, "Exists")
+	}
+
+	return true, nil
+}
+
+func (l Local) URL(name string) (string, error) {
+	return Href(filepath.Base(name)), nil
+}
@@ -0,0 +1,263 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FChannel0/FChannel-Server/config"
+	"github.com/FChannel0/FChannel-Server/util"
+)
+
+// errNotFound is returned by requests for objects the bucket does not have.
+var errNotFound = errors.New("object not found")
+
+// S3 stores media in a bucket of an S3 compatible service such as MinIO.
+// Requests use path style addressing and are signed with AWS signature v4.
+type S3 struct {
+	Endpoint  *url.URL
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	PublicURL string
+	Signed    bool
+	Expiry    time.Duration
+	client    *http.Client
+}
+
+type memFile struct {
+	*bytes.Reader
+}
+
+func (memFile) Close() error {
+	return nil
+}
+
+func NewS3() (*S3, error) {
+	endpoint, err := url.Parse(config.S3Endpoint)
+
+	if err != nil {
+		return nil, util.MakeError(err, "NewS3")
+	}
+
+	if endpoint.Host == "" || config.S3Bucket == "" {
+		return nil, util.MakeError(errors.New("s3endpoint and s3bucket are required"), "NewS3")
+	}
+
+	expiry, _ := strconv.Atoi(config.S3URLExpiry)
+
+	return &S3{
+		Endpoint:  endpoint,
+		Region:    config.S3Region,
+		Bucket:    config.S3Bucket,
+		AccessKey: config.S3AccessKey,
+		SecretKey: config.S3SecretKey,
+		PublicURL: strings.TrimSuffix(config.S3PublicURL, "/"),
+		Signed:    config.S3SignedURLs == "true",
+		Expiry:    time.Duration(expiry) * time.Second,
+		client:    &http.Client{Timeout: 60 * time.Second},
+	}, nil
+}
+
+func (s *S3) Put(name string, path string, mediatype string) error {
+	body, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return util.MakeError(err, "Put")
+	}
+
+	resp, err := s.do("PUT", name, body, mediatype)
+
+	if err != nil {
+		return util.MakeError(err, "Put")
+	}
+
+	resp.Body.Close()
+
+	return nil
+}
+
+func (s *S3) Open(name string) (File, error) {
+	resp, err := s.do("GET", name, nil, "")
+
+	if err != nil {
+		return nil, util.MakeError(err, "Open")
+	}
+
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+
+	if err != nil {
+		return nil, util.MakeError(err, "Open")
+	}
+
+	return memFile{bytes.NewReader(body)}, nil
+}
+
+func (s *S3) Delete(name string) error {
+	resp, err := s.do("DELETE", name, nil, "")
+
+	if err != nil {
+		return util.MakeError(err, "Delete")
+	}
+
+	resp.Body.Close()
+
+	return nil
+}
+
+func (s *S3) Exists(name string) (bool, error) {
+	resp, err := s.do("HEAD", name, nil, "")
+
+	if errors.Is(err, errNotFound) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, util.MakeError(err, "Exists")
+	}
+
+	resp.Body.Close()
+
+	return true, nil
+}
+
+func (s *S3) URL(name string) (string, error) {
+	if s.Signed {
+		return s.presign(name, time.Now().UTC()), nil
+	}
+
+	if s.PublicURL != "" {
+		return s.PublicURL + "/" + url.PathEscape(name), nil
+	}
+
+	return s.objectURL(name).String(), nil
+}
+
+func (s *S3) objectURL(name string) *url.URL {
+	u := *s.Endpoint
+	u.Path = strings.TrimSuffix(s.Endpoint.Path, "/") + "/" + s.Bucket + "/" + name
+	u.RawPath = strings.TrimSuffix(s.Endpoint.EscapedPath(), "/") + "/" + url.PathEscape(s.Bucket) + "/" + url.PathEscape(name)
+	return &u
+}
+
+func (s *S3) do(method string, name string, body []byte, mediatype string) (*http.Response, error) {
+	now := time.Now().UTC()
+	u := s.objectURL(name)
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+
+	if err != nil {
+		return nil, err
+	}
+
+	payload := sha256.Sum256(body)
+	headers := map[string]string{
+		"host":                 u.Host,
+		"x-amz-content-sha256": hex.EncodeToString(payload[:]),
+		"x-amz-date":           now.Format("20060102T150405Z"),
+	}
+
+	if mediatype != "" {
+		headers["content-type"] = mediatype
+	}
+
+	var names []string
+	for k := range headers {
+		names = append(names, k)
+	}
+
+	sort.Strings(names)
+
+	var canonicalHeaders string
+	for _, k := range names {
+		canonicalHeaders += k + ":" + strings.TrimSpace(headers[k]) + "\n"
+	}
+
+	signedHeaders := strings.Join(names, ";")
+	canonicalRequest := strings.Join([]string{method, u.EscapedPath(), "", canonicalHeaders, signedHeaders, headers["x-amz-content-sha256"]}, "\n")
+	signature := s.sign(now, canonicalRequest)
+
+	for k, v := range headers {
+		if k != "host" {
+			req.Header.Set(k, v)
+		}
+	}
+
+	req.ContentLength = int64(len(body))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", s.AccessKey, s.scope(now), signedHeaders, signature))
+
+	resp, err := s.client.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: %w", method, name, errNotFound)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: %s %s", method, name, resp.Status, msg)
+	}
+
+	return resp, nil
+}
+
+// presign returns a GET URL for name that is valid for s.Expiry without any
+// further credentials.
+func (s *S3) presign(name string, now time.Time) string {
+	u := s.objectURL(name)
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", s.AccessKey+"/"+s.scope(now))
+	query.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(s.Expiry.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	canonicalQuery := strings.ReplaceAll(query.Encode(), "+", "%20")
+	canonicalRequest := strings.Join([]string{"GET", u.EscapedPath(), canonicalQuery, "host:" + u.Host + "\n", "host", "UNSIGNED-PAYLOAD"}, "\n")
+
+	u.RawQuery = canonicalQuery + "&X-Amz-Signature=" + s.sign(now, canonicalRequest)
+
+	return u.String()
+}
+
+func (s *S3) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.Region + "/s3/aws4_request"
+}
+
+func (s *S3) sign(now time.Time, canonicalRequest string) string {
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + now.Format("20060102T150405Z") + "\n" + s.scope(now) + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), now.Format("20060102"))
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
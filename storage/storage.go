@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/FChannel0/FChannel-Server/config"
+	"github.com/FChannel0/FChannel-Server/util"
+)
+
+// File is an opened stored file. It has the same methods as multipart.File so
+// stored media can go through the same checks as uploads.
+type File interface {
+	io.Reader
+	io.ReaderAt
+	io.Seeker
+	io.Closer
+}
+
+// Backend stores uploaded media under a flat name such as "<hash>.png".
+type Backend interface {
+	// Put stores the local file at path under name.
+	Put(name string, path string, mediatype string) error
+	Open(name string) (File, error)
+	Delete(name string) error
+	// Exists only returns an error if it can not tell if name is stored.
+	Exists(name string) (bool, error)
+	// URL returns where clients can fetch the file from.
+	URL(name string) (string, error)
+}
+
+// Store is the configured backend, local disk until Init is called.
+var Store Backend = Local{Dir: "./public"}
+
+var nameRegexp = regexp.MustCompile(`/public/([^/]+)$`)
+
+func Init() error {
+	switch config.Storage {
+	case "", "local":
+		Store = Local{Dir: "./public"}
+	case "s3":
+		s3, err := NewS3()
+
+		if err != nil {
+			return util.MakeError(err, "Init")
+		}
+
+		Store = s3
+	default:
+		config.Log.Println("unknown storage backend " + config.Storage + ", using local")
+		Store = Local{Dir: "./public"}
+	}
+
+	return nil
+}
+
+// Name returns the stored name of the file at href.
+func Name(href string) string {
+	match := nameRegexp.FindStringSubmatch(href)
+
+	if len(match) < 2 {
+		return ""
+	}
+
+	return match[1]
+}
+
+func Href(name string) string {
+	return config.Domain + "/public/" + name
+}
+
+// Open returns the file at href. Files still on local disk from before a
+// different backend was configured are opened from there. hrefs that are not
+// stored files are not opened.
+func Open(href string) (File, error) {
+	name := Name(href)
+
+	if name == "" {
+		return nil, util.MakeError(os.ErrNotExist, "Open")
+	}
+
+	if f, err := os.Open(filepath.Join("./public", name)); err == nil {
+		return f, nil
+	}
+
+	f, err := Store.Open(name)
+
+	if err != nil {
+		return nil, util.MakeError(err, "Open")
+	}
+
+	return f, nil
+}
+
+// Delete removes the file at href from the backend and from local disk.
+func Delete(href string) error {
+	name := Name(href)
+
+	if name == "" {
+		return nil
+	}
+
+	local := filepath.Join("./public", name)
+	if _, err := os.Stat(local); err == nil {
+		if err := os.Remove(local); err != nil {
+			return util.MakeError(err, "Delete")
+		}
+	}
+
+	if _, ok := Store.(Local); ok {
+		return nil
+	}
+
+	err := Store.Delete(name)
+	return util.MakeError(err, "Delete")
+}
+
+// Exists reports if the file at href is stored locally or in the backend. It
+// returns an error when the backend can not be reached, files are only missing
+// if the backend says so.
+func Exists(href string) (bool, error) {
+	name := Name(href)
+
+	if name == "" {
+		return false, nil
+	}
+
+	if _, err := os.Stat(filepath.Join("./public", name)); err == nil {
+		return true, nil
+	}
+
+	exists, err := Store.Exists(name)
+	return exists, util.MakeError(err, "Exists")
+}
@@ -0,0 +1,218 @@
+package util
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+)
+
+// Blurhash encodes an image as a short string of a few DCT components, see
+// https://github.com/woltapp/blurhash for the algorithm. Mastodon and other
+// fediverse software send it with attachments as a placeholder while loading.
+
+const blurhashCharacters = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// BlurhashEncode returns the blurhash of img with xComp by yComp components,
+// each between 1 and 9. Large images should be scaled down first.
+func BlurhashEncode(img image.Image, xComp int, yComp int) (string, error) {
+	if xComp < 1 || xComp > 9 || yComp < 1 || yComp > 9 {
+		return "", MakeError(errors.New("components must be between 1 and 9"), "BlurhashEncode")
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	if width == 0 || height == 0 {
+		return "", MakeError(errors.New("empty image"), "BlurhashEncode")
+	}
+
+	// convert to linear rgb once instead of for every component
+	pixels := make([][3]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			pixels[y*width+x] = [3]float64{sRGBToLinear(int(r >> 8)), sRGBToLinear(int(g >> 8)), sRGBToLinear(int(b >> 8))}
+		}
+	}
+
+	factors := make([][3]float64, 0, xComp*yComp)
+	for j := 0; j < yComp; j++ {
+		for i := 0; i < xComp; i++ {
+			var factor [3]float64
+
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					basis := math.Cos(math.Pi*float64(i*x)/float64(width)) * math.Cos(math.Pi*float64(j*y)/float64(height))
+					p := pixels[y*width+x]
+					factor[0] += basis * p[0]
+					factor[1] += basis * p[1]
+					factor[2] += basis * p[2]
+				}
+			}
+
+			scale := normalisation / float64(width*height)
+			factors = append(factors, [3]float64{factor[0] * scale, factor[1] * scale, factor[2] * scale})
+		}
+	}
+
+	var hash strings.Builder
+
+	hash.WriteString(encode83((xComp-1)+(yComp-1)*9, 1))
+
+	maxValue := 1.0
+	if len(factors) > 1 {
+		var actualMax float64
+		for _, f := range factors[1:] {
+			actualMax = math.Max(actualMax, math.Max(math.Abs(f[0]), math.Max(math.Abs(f[1]), math.Abs(f[2]))))
+		}
+
+		quantisedMax := int(math.Max(0, math.Min(82, math.Floor(actualMax*166-0.5))))
+		maxValue = float64(quantisedMax+1) / 166
+		hash.WriteString(encode83(quantisedMax, 1))
+	} else {
+		hash.WriteString(encode83(0, 1))
+	}
+
+	dc := factors[0]
+	hash.WriteString(encode83(linearTosRGB(dc[0])<<16+linearTosRGB(dc[1])<<8+linearTosRGB(dc[2]), 4))
+
+	for _, f := range factors[1:] {
+		quant := func(v float64) int {
+			return int(math.Max(0, math.Min(18, math.Floor(signPow(v/maxValue, 0.5)*9+9.5))))
+		}
+
+		hash.WriteString(encode83(quant(f[0])*19*19+quant(f[1])*19+quant(f[2]), 2))
+	}
+
+	return hash.String(), nil
+}
+
+// BlurhashDecode renders hash as an image of the given size.
+func BlurhashDecode(hash string, width int, height int) (image.Image, error) {
+	if len(hash) < 6 {
+		return nil, MakeError(errors.New("blurhash too short"), "BlurhashDecode")
+	}
+
+	sizeFlag, err := decode83(hash[0:1])
+	if err != nil {
+		return nil, MakeError(err, "BlurhashDecode")
+	}
+
+	numX := sizeFlag%9 + 1
+	numY := sizeFlag/9 + 1
+
+	if len(hash) != 4+2*numX*numY {
+		return nil, MakeError(errors.New("blurhash length does not match its components"), "BlurhashDecode")
+	}
+
+	quantisedMax, err := decode83(hash[1:2])
+	if err != nil {
+		return nil, MakeError(err, "BlurhashDecode")
+	}
+
+	maxValue := float64(quantisedMax+1) / 166
+
+	colors := make([][3]float64, numX*numY)
+	for i := range colors {
+		if i == 0 {
+			value, err := decode83(hash[2:6])
+			if err != nil {
+				return nil, MakeError(err, "BlurhashDecode")
+			}
+
+			colors[i] = [3]float64{sRGBToLinear(value >> 16), sRGBToLinear((value >> 8) & 255), sRGBToLinear(value & 255)}
+			continue
+		}
+
+		value, err := decode83(hash[4+i*2 : 6+i*2])
+		if err != nil {
+			return nil, MakeError(err, "BlurhashDecode")
+		}
+
+		colors[i] = [3]float64{
+			signPow(float64(value/(19*19)-9)/9, 2) * maxValue,
+			signPow(float64((value/19)%19-9)/9, 2) * maxValue,
+			signPow(float64(value%19-9)/9, 2) * maxValue,
+		}
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var c [3]float64
+
+			for j := 0; j < numY; j++ {
+				for i := 0; i < numX; i++ {
+					basis := math.Cos(math.Pi*float64(x*i)/float64(width)) * math.Cos(math.Pi*float64(y*j)/float64(height))
+					f := colors[i+j*numX]
+					c[0] += f[0] * basis
+					c[1] += f[1] * basis
+					c[2] += f[2] * basis
+				}
+			}
+
+			img.SetNRGBA(x, y, color.NRGBA{uint8(linearTosRGB(c[0])), uint8(linearTosRGB(c[1])), uint8(linearTosRGB(c[2])), 255})
+		}
+	}
+
+	return img, nil
+}
+
+func encode83(value int, length int) string {
+	var result strings.Builder
+
+	for i := 1; i <= length; i++ {
+		digit := (value / int(math.Pow(83, float64(length-i)))) % 83
+		result.WriteByte(blurhashCharacters[digit])
+	}
+
+	return result.String()
+}
+
+func decode83(str string) (int, error) {
+	var value int
+
+	for _, c := range str {
+		digit := strings.IndexRune(blurhashCharacters, c)
+
+		if digit < 0 {
+			return 0, errors.New("invalid blurhash character")
+		}
+
+		value = value*83 + digit
+	}
+
+	return value, nil
+}
+
+func sRGBToLinear(value int) float64 {
+	v := float64(value) / 255
+
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearTosRGB(value float64) int {
+	v := math.Max(0, math.Min(1, value))
+
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(value float64, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exp), value)
+}
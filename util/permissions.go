@@ -0,0 +1,107 @@
+package util
+
+import (
+	"strings"
+	"time"
+
+	"github.com/FChannel0/FChannel-Server/config"
+)
+
+// Staff are given a role in the type of their boardaccess. Each role comes
+// with a set of permissions, custom staff have theirs stored beside their
+// access code. Board owners keep the admin type they always had.
+
+const (
+	RoleOwner     = "admin"
+	RoleModerator = "mod"
+	RoleJanitor   = "janitor"
+	RoleCustom    = "custom"
+)
+
+const (
+	PermDelete     = "delete"
+	PermBan        = "ban"
+	PermViewIP     = "viewip"
+	PermStickyLock = "stickylock"
+	PermBlacklist  = "blacklist"
+	PermStaff      = "staff"
+)
+
+var Permissions = []string{PermDelete, PermBan, PermViewIP, PermStickyLock, PermBlacklist, PermStaff}
+
+var RolePermissions = map[string][]string{
+	RoleOwner:     Permissions,
+	RoleModerator: {PermDelete, PermBan, PermViewIP, PermStickyLock},
+	RoleJanitor:   {PermDelete},
+}
+
+// BanUnlimited is the longest ban of staff who can ban for any length, a
+// longest ban of 0 allows no bans.
+const BanUnlimited = -1
+
+// longest ban each role can give in seconds
+var RoleBanMax = map[string]int{
+	RoleOwner:     BanUnlimited,
+	RoleModerator: 30 * 24 * 60 * 60,
+}
+
+type StaffAccess struct {
+	Role        string
+	Permissions []string
+	BanMax      int
+}
+
+// GetStaffAccess returns the role and permissions the access code has on
+// board, and false if it has no access to the board.
+func GetStaffAccess(code string, board string) (StaffAccess, bool) {
+	var access StaffAccess
+
+	hasAuth, role := HasAuth(code, board)
+
+	if !hasAuth {
+		return access, false
+	}
+
+	access.Role = role
+
+	if role != RoleCustom {
+		access.Permissions = RolePermissions[role]
+		access.BanMax = RoleBanMax[role]
+		return access, true
+	}
+
+	var permissions string
+
+	query := `select permissions, banmax from boardaccess where code=$1`
+	if err := config.DB.QueryRow(query, code).Scan(&permissions, &access.BanMax); err != nil {
+		return access, true
+	}
+
+	for _, e := range strings.Split(permissions, ",") {
+		if IsInStringArray(Permissions, e) {
+			access.Permissions = append(access.Permissions, e)
+		}
+	}
+
+	return access, true
+}
+
+// HasPermission returns true if the access code is allowed to do perm on
+// board.
+func HasPermission(code string, board string, perm string) bool {
+	access, ok := GetStaffAccess(code, board)
+	return ok && access.Can(perm)
+}
+
+func (access StaffAccess) Can(perm string) bool {
+	return IsInStringArray(access.Permissions, perm)
+}
+
+// CanBanFor returns true if staff with access can ban for length.
+func (access StaffAccess) CanBanFor(length time.Duration) bool {
+	if !access.Can(PermBan) {
+		return false
+	}
+
+	return access.BanMax == BanUnlimited || length <= time.Duration(access.BanMax)*time.Second
+}
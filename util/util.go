@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"mime/multipart"
+	"net"
 	"os"
 	"path"
 	"regexp"
@@ -37,6 +38,35 @@ func IsTorExit(ip string) bool {
 	return isExit
 }
 
+// IPRange returns the network of ip with a prefix of bits for IPv4 addresses
+// and bits6 for IPv6 ones, so a ban covers the whole range. A prefix of 0
+// returns ip as is.
+func IPRange(ip string, bits int, bits6 int) (string, error) {
+	addr := net.ParseIP(ip)
+
+	if cidr, _, err := net.ParseCIDR(ip); err == nil {
+		addr = cidr
+	}
+
+	if addr == nil {
+		return "", MakeError(errors.New("invalid IP "+ip), "IPRange")
+	}
+
+	if v4 := addr.To4(); v4 != nil {
+		if bits <= 0 || bits >= 32 {
+			return ip, nil
+		}
+
+		return fmt.Sprintf("%s/%d", v4.Mask(net.CIDRMask(bits, 32)), bits), nil
+	}
+
+	if bits6 <= 0 || bits6 >= 128 {
+		return ip, nil
+	}
+
+	return fmt.Sprintf("%s/%d", addr.Mask(net.CIDRMask(bits6, 128)), bits6), nil
+}
+
 func StripTransferProtocol(value string) string {
 	re := regexp.MustCompile("(http://|https://)?(www.)?")
 	value = re.ReplaceAllString(value, "")
@@ -21,6 +21,9 @@ type Verify struct {
 	Created    string
 	Board      string
 	Label      string
+	// permissions and longest ban in seconds of custom staff
+	Permissions []string
+	BanMax      int
 }
 
 type VerifyCooldown struct {
@@ -85,8 +88,8 @@ func (verify Verify) CreateBoardMod() error {
 			verify.Label = "Anon"
 		}
 
-		query = `insert into boardaccess (identifier, code, board, type, label) values ($1, $2, $3, $4, $5)`
-		if _, err = config.DB.Exec(query, verify.Identifier, pass, verify.Board, verify.Type, verify.Label); err != nil {
+		query = `insert into boardaccess (identifier, code, board, type, label, permissions, banmax) values ($1, $2, $3, $4, $5, $6, $7)`
+		if _, err = config.DB.Exec(query, verify.Identifier, pass, verify.Board, verify.Type, verify.Label, strings.Join(verify.Permissions, ","), verify.BanMax); err != nil {
 			return MakeError(err, "CreateBoardMod")
 		}
 	}
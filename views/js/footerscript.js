@@ -6,18 +6,23 @@ imgArray.forEach(function(img, i){
         var id = img.getAttribute("id");
         var media = document.getElementById("media-" + id);
         var sensitive = document.getElementById("sensitive-" + id);     
+        var source = img.parentNode.tagName == "PICTURE" ? img.parentNode.querySelector("source") : null;
         
         if(img.getAttribute("enlarge") == "0")
         {
             var attachment = img.getAttribute("attachment");
             img.setAttribute("enlarge", "1");
             img.setAttribute("style", "float: left; margin-right: 10px; cursor: pointer; max-width: 100%");
+            if(source)
+                source.srcset = source.getAttribute("original");
             img.src = attachment;
         }
         else
         {
             var preview = img.getAttribute("preview");
             img.setAttribute("enlarge", "0");
+            if(source)
+                source.removeAttribute("srcset");
             if(img.getAttribute("main") == 1)
             {
                 img.setAttribute("style", "float: left; margin-right: 10px; max-width: 250px; max-height: 250px; cursor: pointer;");